@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/ghapi"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/metrics"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// hookKey identifies a webhook across check cycles (repo is empty for organization webhooks)
+type hookKey struct {
+	scope string
+	repo  string
+	id    int
+}
+
+// collectDeliveries fetches all deliveries of the webhook since the last seen delivery and updates the delivery metrics.
+// The first time a webhook is seen, only its latest delivery is remembered, so that the history isn't counted in one go.
+func (m *monitor) collectDeliveries(ctx context.Context, scope, repo string, hook ghapi.GHAPIResponseHook) []ghapi.GHAPIResponseHookDelivery {
+	key := hookKey{scope: scope, repo: repo, id: hook.ID}
+
+	m.mu.Lock()
+	m.seenHooks[key] = true
+	cursor, known := m.deliveryCursors[key]
+	m.mu.Unlock()
+
+	var deliveries []ghapi.GHAPIResponseHookDelivery
+	var err error
+	if scope == types.WEBHOOK_SCOPE_ORG {
+		deliveries, err = m.client.GetOrgHookDeliveries(ctx, hook.ID, cursor)
+	} else {
+		deliveries, err = m.client.GetRepoHookDeliveries(ctx, repo, hook.ID, cursor)
+	}
+	if err != nil {
+		log.Errorf("Failed to get deliveries for hook '%s'\n%+v", hook.URL, err)
+		metrics.WebhookFailedDeliveryListTotal.WithLabelValues(m.hookSeries.track(key, metrics.WebhookFailedDeliveryListTotal, m.labelValues(scope, repo, strconv.Itoa(hook.ID), ghapi.ErrorLabel(err)))...).Inc()
+		return nil
+	}
+
+	// move the cursor to the newest delivery
+	for _, delivery := range deliveries {
+		if delivery.ID > cursor {
+			cursor = delivery.ID
+		}
+	}
+	m.mu.Lock()
+	m.deliveryCursors[key] = cursor
+	m.mu.Unlock()
+
+	if !known {
+		log.Debugf("Initialized delivery cursor for hook '%s' at delivery '%d'", hook.URL, cursor)
+		return nil
+	}
+
+	for _, delivery := range deliveries {
+		metrics.WebhookDeliveriesTotal.WithLabelValues(m.hookSeries.track(key, metrics.WebhookDeliveriesTotal, m.labelValues(scope, repo, strconv.Itoa(hook.ID), metrics.TargetLabel(hook.Config.URL), strconv.Itoa(delivery.StatusCode), delivery.Event, strconv.FormatBool(delivery.Redelivery)))...).Inc()
+		metrics.WebhookDeliveryDurationSeconds.WithLabelValues(m.hookSeries.track(key, metrics.WebhookDeliveryDurationSeconds, m.labelValues(scope, repo, strconv.Itoa(hook.ID), metrics.TargetLabel(hook.Config.URL)))...).Observe(delivery.Duration)
+	}
+	log.Debugf("Collected %d new deliveries for hook '%s'", len(deliveries), hook.URL)
+
+	return deliveries
+}
+
+// pruneHooks forgets the delivery cursors, pending redeliveries and metric series of webhooks which were not seen in the last check,
+// unless listing the webhooks of their repository failed
+func (m *monitor) pruneHooks(failedRepos map[string]bool) {
+	gone := func(key hookKey) bool {
+		return !m.seenHooks[key] && !failedRepos[key.repo]
+	}
+	for key := range m.deliveryCursors {
+		if gone(key) {
+			delete(m.deliveryCursors, key)
+		}
+	}
+	for guid, pending := range m.pendingRedeliveries {
+		if gone(pending.hookKey()) {
+			delete(m.pendingRedeliveries, guid)
+		}
+	}
+	m.hookSeries.prune(func(owner interface{}) bool {
+		return !gone(owner.(hookKey))
+	})
+	m.seenHooks = map[hookKey]bool{}
+}
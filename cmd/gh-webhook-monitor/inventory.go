@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/ghapi"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+)
+
+// repoInventory holds the list of repositories shared by the refresh loop (writer) and the check loop (reader).
+// A failed refresh keeps the last good list, so that coverage isn't lost until the next refresh.
+type repoInventory struct {
+	mu sync.RWMutex
+
+	repos   []ghapi.Repository
+	skipped map[string]int // number of repositories skipped by reason
+
+	config      *types.RepositoryConfig // configuration the list was generated from
+	refreshedAt time.Time               // time of the last successful refresh
+}
+
+// repoInventorySnapshot is a consistent view of the inventory, which must not be modified
+type repoInventorySnapshot struct {
+	repos       []ghapi.Repository
+	skipped     map[string]int
+	config      *types.RepositoryConfig
+	refreshedAt time.Time
+}
+
+// snapshot returns the current state of the inventory
+func (inventory *repoInventory) snapshot() repoInventorySnapshot {
+	inventory.mu.RLock()
+	defer inventory.mu.RUnlock()
+	return repoInventorySnapshot{
+		repos:       inventory.repos,
+		skipped:     inventory.skipped,
+		config:      inventory.config,
+		refreshedAt: inventory.refreshedAt,
+	}
+}
+
+// update replaces the list of repositories with the result of a successful refresh
+func (inventory *repoInventory) update(repos []ghapi.Repository, skipped map[string]int, config *types.RepositoryConfig) {
+	inventory.mu.Lock()
+	defer inventory.mu.Unlock()
+	inventory.repos = repos
+	inventory.skipped = skipped
+	inventory.config = config
+	inventory.refreshedAt = time.Now()
+}
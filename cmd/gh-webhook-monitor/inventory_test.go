@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/ghapi"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+)
+
+func TestRepoInventoryConcurrentAccess(t *testing.T) {
+	var inventory repoInventory
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			repos := []ghapi.Repository{{Name: fmt.Sprintf("myorg/repo-%d", i)}}
+			inventory.update(repos, map[string]int{ghapi.REPO_SKIP_REASON_EXCLUDED: i}, &types.RepositoryConfig{})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			snapshot := inventory.snapshot()
+			// the repos and skip counts of a snapshot belong to the same update
+			if len(snapshot.repos) == 1 && snapshot.repos[0].Name != fmt.Sprintf("myorg/repo-%d", snapshot.skipped[ghapi.REPO_SKIP_REASON_EXCLUDED]) {
+				t.Errorf("Inconsistent snapshot: repos %v, skipped %v", snapshot.repos, snapshot.skipped)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestRefreshRepoListKeepsLastGoodList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	httpClient, retry := ghapi.HTTPClient, ghapi.Retry
+	defer func() { ghapi.HTTPClient, ghapi.Retry = httpClient, retry }()
+	ghapi.HTTPClient = server.Client()
+	ghapi.Retry.MaxRetries = 0
+
+	cfg := &types.Config{
+		Repositories: types.RepositoryConfig{
+			Discovery: types.RepositoryDiscoveryConfig{Enabled: true},
+		},
+	}
+	m := &monitor{
+		client: &ghapi.Client{
+			Auth:         &ghapi.PersonalAccessToken{Token: "test", Endpoints: &ghapi.GitHubEndpoints{APIBaseURL: server.URL}},
+			Organization: "myorg",
+		},
+		config: newConfigHolder("", cfg),
+	}
+
+	previous := []ghapi.Repository{{Name: "myorg/svc-a"}, {Name: "myorg/svc-b"}}
+	m.inventory.update(previous, map[string]int{}, &cfg.Repositories)
+	before := m.inventory.snapshot()
+
+	if err := m.refreshRepoList(context.Background()); err == nil {
+		t.Fatal("refreshRepoList succeeded despite the failing API")
+	}
+
+	after := m.inventory.snapshot()
+	if len(after.repos) != len(previous) || after.repos[0].Name != previous[0].Name || after.repos[1].Name != previous[1].Name {
+		t.Errorf("refreshRepoList replaced the repos %v with %v", previous, after.repos)
+	}
+	if !after.refreshedAt.Equal(before.refreshedAt) {
+		t.Errorf("refreshRepoList moved the refresh time from %v to %v", before.refreshedAt, after.refreshedAt)
+	}
+}
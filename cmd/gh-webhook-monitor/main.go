@@ -2,16 +2,19 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"os"
-	"regexp"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/config"
 	"github.com/iwilltry42/gh-webhook-monitor/pkg/ghapi"
 	"github.com/iwilltry42/gh-webhook-monitor/pkg/metrics"
 	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
@@ -19,242 +22,371 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func configFromEnv() (*ghapi.GitHubAppInstallation, *types.RepositoryConfig, *types.WebhookConfig, time.Duration, time.Duration, error) {
-
-	// Setup GitHub App used for authentication
-	ghApp := ghapi.GitHubApp{
-		ID:      os.Getenv("GWM_GH_APP_ID"),
-		PemFile: os.Getenv("GWM_GH_APP_PEM"),
+// newClient creates the GitHub API client from the configuration
+func newClient(config *types.GitHubConfig) (*ghapi.Client, error) {
+	// GitHub API endpoints (github.com or GitHub Enterprise Server)
+	ghEndpoints, err := ghapi.NewGitHubEndpoints(config.APIBaseURL)
+	if err != nil {
+		return nil, err
 	}
-
-	ghAppInstallation := ghapi.GitHubAppInstallation{
-		ID:        os.Getenv("GWM_GH_APP_INST_ID"),
-		ParentApp: &ghApp,
+	if config.UploadURL != "" {
+		ghEndpoints.UploadBaseURL = strings.TrimSuffix(config.UploadURL, "/")
 	}
-
-	// wait time: time to wait between iterations
-	wt := strings.TrimSpace(os.Getenv("GWM_WAIT_TIME"))
-
-	var waitTime time.Duration
-	if wt == "" {
-		waitTime = types.DEFAULT_WAIT_TIME
-	} else {
-		var err error
-		waitTime, err = time.ParseDuration(wt)
-		if err != nil {
-			return nil, nil, nil, 0, 0, fmt.Errorf("Failed to parse wait time '%s' to time.Duration format", wt)
-		}
+	if config.GraphQLURL != "" {
+		ghEndpoints.GraphQLURL = config.GraphQLURL
 	}
+	log.Debugf("GitHub API Endpoints: %+v", ghEndpoints)
 
-	// repo refresh wait time: time to wait before refreshing the list of repositories again
-	rrwt := strings.TrimSpace(os.Getenv("GWM_REPO_REFRESH_WAIT_TIME"))
+	// pagination: page size and maximum number of pages for GitHub API list requests
+	ghapi.Pagination.PerPage = config.PerPage
+	ghapi.Pagination.MaxPages = config.MaxPages
 
-	var repoRefreshWaitTime time.Duration
-	if rrwt == "" {
-		repoRefreshWaitTime = types.DEFAULT_REPO_REFRESH_WAIT_TIME
-	} else {
-		var err error
-		repoRefreshWaitTime, err = time.ParseDuration(rrwt)
-		if err != nil {
-			return nil, nil, nil, 0, 0, fmt.Errorf("Failed to parse repo refresh wait time '%s' to time.Duration format", rrwt)
-		}
-	}
+	// limit concurrent requests to avoid GitHub's secondary rate limits
+	ghapi.SetMaxConcurrentRequests(config.MaxConcurrentRequests)
 
-	if os.Getenv("GWM_DEBUG") != "" {
-		log.SetLevel(log.DebugLevel)
-	}
+	// leave the rest of the rate limit quota to other tools sharing the credentials
+	ghapi.RateLimitBudget = config.RateLimitBudget
 
-	// Webhook Configuration
-	webhookConfig := types.WebhookConfig{}
+	// retry transient failures (with jitter differing between instances)
+	rand.Seed(time.Now().UnixNano())
+	ghapi.Retry.MaxRetries = config.MaxRetries
+	ghapi.Retry.InitialBackoff = config.RetryBackoff
 
-	// Regexp to match against webhook target URLs
-	webhookTargetRegexp := strings.TrimSpace(os.Getenv("GWM_WEBHOOKS_FILTER_TARGET_REGEXP"))
-	if webhookTargetRegexp != "" {
-		webhookConfig.FilterTargetURLRegexp = regexp.MustCompile(webhookTargetRegexp)
-	}
-	log.Debugf("Webhook Filter Target Regexp '%+v'", webhookConfig.FilterTargetURLRegexp)
+	// give up on requests which take too long (e.g. hanging connections)
+	ghapi.RequestTimeout = config.RequestTimeout
 
-	// Generate Repository Search Config
-	targetRepositoryListConfig := types.RepositoryConfig{
-		IncludeRepositories: []string{},
-		FilterTeamSlugs:     []string{},
-		ExcludeRepositories: []string{},
+	client := ghapi.Client{
+		Organization: config.Organization,
 	}
 
-	includeRepos := strings.Split(os.Getenv("GWM_REPOS_INCLUDE"), ",")
-	for _, r := range includeRepos {
-		r = strings.TrimSpace(r)
-		if r != "" {
-			targetRepositoryListConfig.IncludeRepositories = append(targetRepositoryListConfig.IncludeRepositories, r)
+	if config.Token != "" || config.TokenFile != "" {
+		// Setup personal access token used for authentication
+		pat, err := ghapi.NewPersonalAccessToken(config.Token, config.TokenFile, ghEndpoints)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	excludeRepos := strings.Split(os.Getenv("GWM_REPOS_EXCLUDE"), ",")
-	for _, r := range excludeRepos {
-		r = strings.TrimSpace(r)
-		if r != "" {
-			targetRepositoryListConfig.ExcludeRepositories = append(targetRepositoryListConfig.ExcludeRepositories, r)
+		pat.Organization = config.Organization
+		client.Auth = pat
+	} else {
+		// Setup GitHub App used for authentication
+		ghApp := ghapi.GitHubApp{
+			ID:        config.App.ID,
+			PemFile:   config.App.PemFile,
+			Endpoints: ghEndpoints,
 		}
-	}
 
-	teamSlugs := strings.Split(os.Getenv("GWM_REPOS_FILTER_TEAM_SLUGS"), ",")
-	for _, ts := range teamSlugs {
-		ts = strings.TrimSpace(ts)
-		if ts != "" {
-			targetRepositoryListConfig.FilterTeamSlugs = append(targetRepositoryListConfig.FilterTeamSlugs, ts)
+		if config.App.InstallationID != "" {
+			client.Auth = &ghapi.GitHubAppInstallation{
+				ID:        config.App.InstallationID,
+				ParentApp: &ghApp,
+				Endpoints: ghEndpoints,
+			}
+		} else {
+			// no installation given: monitor all installations of the App
+			client.Auth = &ghApp
 		}
 	}
 
-	return &ghAppInstallation, &targetRepositoryListConfig, &webhookConfig, waitTime, repoRefreshWaitTime, nil
+	return &client, nil
 }
 
-func checkWebhooks(ctx context.Context, ghAppInstallation *ghapi.GitHubAppInstallation, repos []string, webhookConfig *types.WebhookConfig) {
-	// renew token in case it expired
-	if time.Now().After(ghAppInstallation.TokenExpirationTime) {
-		log.Debugln("Renewing App Installation Token...")
-		if err := ghAppInstallation.RefreshToken(context.Background()); err != nil {
-			log.Errorln("Failed to get GH App Installation Token")
-			log.Fatalln(err)
+// authenticate verifies the client's credentials against GitHub and fills in the details needed later on
+func authenticate(ctx context.Context, client *ghapi.Client) error {
+	switch auth := client.Auth.(type) {
+	case *ghapi.GitHubAppInstallation:
+		// get some installation details
+		if err := auth.GetDetails(ctx); err != nil {
+			return fmt.Errorf("Failed to get App Installation Details: %w", err)
 		}
-	}
 
-	// Reset Metrics, where needed
-	metrics.WebhookLastStatusCodeGroup.Reset() // reset all metrics in this vector
+		// authenticate against GitHub as a GitHub app
+		if err := auth.RefreshToken(ctx); err != nil {
+			return fmt.Errorf("Failed to get GH App Installation Token: %w", err)
+		}
 
-	// loop through list of repositories
-	for _, repo := range repos {
-		log.Debugf("Getting hooks for repo '%s'...", repo)
-		resp, err := ghAppInstallation.DoAPIRequest(http.MethodGet, fmt.Sprintf("/repos/%s/hooks", repo))
-		if err != nil {
-			log.Errorf("Failed to get hooks for repo '%s'\n%+v", repo, err)
-			metrics.RepositoryFailedWebhookListTotal.WithLabelValues(repo, "requestError").Inc()
-			continue
+		if client.Organization == "" {
+			client.Organization = auth.Organization
 		}
 
-		var hookResponse []ghapi.GHAPIResponseHook
+	case *ghapi.PersonalAccessToken:
+		if auth.IsFineGrained() {
+			log.Infoln("Authenticating with a fine-grained personal access token: make sure it has read access to the 'Webhooks' repository permission")
+			return nil
+		}
 
-		respBody, err := ioutil.ReadAll(resp.Body)
+		// discover the scopes of the classic token, so that missing permissions are flagged early
+		scopes, err := auth.GetScopes(ctx)
 		if err != nil {
-			log.Errorf("Failed to read response body\n%+v", err)
-			metrics.RepositoryFailedWebhookListTotal.WithLabelValues(repo, "readResponseError").Inc()
-			continue
+			return fmt.Errorf("Failed to authenticate with personal access token: %w", err)
+		}
+		for _, scope := range scopes {
+			metrics.APITokenScopes.WithLabelValues(scope).Set(1)
+		}
+		log.Infof("Personal access token has scopes %v", scopes)
+		if !ghapi.HasRequiredScopes(scopes) {
+			log.Warnln("Personal access token is missing the 'admin:repo_hook' scope (or 'read:repo_hook'), listing webhooks will fail!")
 		}
+	}
+
+	return nil
+}
 
-		resp.Body.Close()
+// checkWebhooks checks the last response of all webhooks of the given repositories and of the organization.
+// The repositories are checked concurrently by a pool of workers.
+func (m *monitor) checkWebhooks(ctx context.Context, repos []ghapi.Repository) {
+	start := time.Now()
+	m.statuses = nil
 
-		if err := json.Unmarshal(respBody, &hookResponse); err != nil {
-			log.Errorf("Failed to unmarshal hook response for repo '%s'\n%+v", repo, err)
-			metrics.RepositoryFailedWebhookListTotal.WithLabelValues(repo, "unmarshalResponseBodyError").Inc()
-			continue
+	// forget the metric series of repositories which left the inventory
+	inventory := map[string]bool{}
+	for _, repo := range repos {
+		inventory[repo.Name] = true
+	}
+	m.repoSeries.prune(func(owner interface{}) bool {
+		return inventory[owner.(string)]
+	})
+
+	failedRepos := map[string]bool{}
+	defer func() {
+		// serve the statuses of the completed cycle (an aborted cycle is incomplete, the monitor is stopped anyway)
+		if ctx.Err() == nil {
+			metrics.WebhookStatuses.Publish(m.client.Organization, m.client.InstallationID(), m.statuses, failedRepos)
 		}
+		m.pruneHooks(failedRepos)
+		// redeliveries requested while shutting down would fail anyway
+		if m.webhookConfig.Redelivery.Enabled && ctx.Err() == nil {
+			m.processRedeliveries(ctx)
+		}
+		metrics.CheckCycleDurationSeconds.WithLabelValues(m.labelValues()...).Set(time.Since(start).Seconds())
+	}()
 
-		for _, hook := range hookResponse {
-			if webhookConfig.FilterTargetURLRegexp != nil && !webhookConfig.FilterTargetURLRegexp.MatchString(hook.Config.URL) { // TODO: add function to filter webhooks before continuing
-				log.Debugf("Webhook Target URL '%s' does not match provided Regexp ('%s'), ignoring...", hook.Config.URL, webhookConfig.FilterTargetURLRegexp)
-				continue
+	// organization webhooks
+	if m.webhookConfig.HasScope(types.WEBHOOK_SCOPE_ORG) {
+		log.Debugf("Getting hooks for org '%s'...", m.client.Organization)
+		hookResponse, err := m.client.GetOrgHooks(ctx)
+		if err != nil {
+			log.Errorf("Failed to get hooks for org '%s'\n%+v", m.client.Organization, err)
+			failedRepos[""] = true
+			metrics.OrganizationFailedWebhookListTotal.WithLabelValues(m.labelValues(ghapi.ErrorLabel(err))...).Inc()
+		} else {
+			for _, hook := range hookResponse {
+				m.processHook(ctx, types.WEBHOOK_SCOPE_ORG, ghapi.Repository{}, hook)
 			}
-			log.Infof("Repo %s - Hook %s -> Target %s :: Last Status Code %d (msg: %s)", repo, hook.URL, hook.Config.URL, hook.LastResponse.Code, hook.LastResponse.Status)
-
-			// CodeGroup
-			var cgFound *metrics.CodeGroup
-			for _, cg := range metrics.CodeGroups {
-				if hook.LastResponse.Code >= cg.LowerBound && hook.LastResponse.Code <= cg.LowerBound {
-					metrics.WebhookLastStatusCodeGroup.WithLabelValues(repo, hook.URL, strconv.Itoa(hook.ID), hook.Config.URL, hook.LastResponse.Status, cg.Name).Set(1)
-					cgFound = &cg
-					break
+		}
+	}
+
+	if !m.webhookConfig.HasScope(types.WEBHOOK_SCOPE_REPO) {
+		return
+	}
+
+	// distribute the list of repositories across the workers
+	queue := make(chan ghapi.Repository)
+	var wg sync.WaitGroup
+	for i := 0; i < m.webhookConfig.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for repo := range queue {
+				if !m.checkRepoWebhooks(ctx, repo) {
+					m.mu.Lock()
+					failedRepos[repo.Name] = true
+					m.mu.Unlock()
 				}
 			}
-			if cgFound == nil {
-				metrics.WebhookLastStatusCodeGroup.WithLabelValues(repo, hook.URL, strconv.Itoa(hook.ID), hook.Config.URL, hook.LastResponse.Status, metrics.CodeGroupOthers.Name).Set(1)
-				metrics.WebhookLastStatusCodeTotal.WithLabelValues(repo, hook.URL, strconv.Itoa(hook.ID), hook.Config.URL, hook.LastResponse.Status, fmt.Sprintf("%d", hook.LastResponse.Code), metrics.CodeGroupOthers.Name).Inc()
-			} else {
-				metrics.WebhookLastStatusCodeTotal.WithLabelValues(repo, hook.URL, strconv.Itoa(hook.ID), hook.Config.URL, hook.LastResponse.Status, fmt.Sprintf("%d", hook.LastResponse.Code), cgFound.Name).Inc()
-			}
-			continue
+		}()
+	}
+
+	for _, repo := range repos {
+		if ctx.Err() != nil {
+			break
 		}
+		queue <- repo
 	}
+	close(queue)
+	wg.Wait()
 }
 
-func main() {
-	var err error
+// checkRepoWebhooks processes all webhooks of a single repository and tells whether they could be listed
+func (m *monitor) checkRepoWebhooks(ctx context.Context, repo ghapi.Repository) bool {
+	start := time.Now()
+	defer func() {
+		metrics.RepositoryCheckDurationSeconds.WithLabelValues(m.labelValues()...).Observe(time.Since(start).Seconds())
+	}()
 
-	// expose metrics for Prometheus
-	http.Handle("/metrics", promhttp.Handler())
+	log.Debugf("Getting hooks for repo '%s'...", repo.Name)
+	hookResponse, err := m.client.GetRepoHooks(ctx, repo.Name)
+	if err != nil {
+		log.Errorf("Failed to get hooks for repo '%s'\n%+v", repo.Name, err)
+		metrics.RepositoryFailedWebhookListTotal.WithLabelValues(m.repoSeries.track(repo.Name, metrics.RepositoryFailedWebhookListTotal, m.labelValues(repo.Name, ghapi.ErrorLabel(err)))...).Inc()
+		return false
+	}
+
+	for _, hook := range hookResponse {
+		m.processHook(ctx, types.WEBHOOK_SCOPE_REPO, repo, hook)
+	}
+	return true
+}
+
+// processHook updates the metrics for a single webhook of the given scope (repo is empty for organization webhooks)
+func (m *monitor) processHook(ctx context.Context, scope string, repo ghapi.Repository, hook ghapi.GHAPIResponseHook) {
+	if m.webhookConfig.FilterTargetURLRegexp != nil && !m.webhookConfig.FilterTargetURLRegexp.MatchString(hook.Config.URL) {
+		log.Debugf("Webhook Target URL '%s' does not match provided Regexp ('%s'), ignoring...", hook.Config.URL, m.webhookConfig.FilterTargetURLRegexp.String())
+		return
+	}
+	if scope == types.WEBHOOK_SCOPE_ORG {
+		log.Infof("Org %s - Hook %s -> Target %s :: Last Status Code %d (msg: %s)", m.client.Organization, hook.URL, hook.Config.URL, hook.LastResponse.Code, hook.LastResponse.Status)
+	} else {
+		log.Infof("Repo %s - Hook %s -> Target %s :: Last Status Code %d (msg: %s)", repo.Name, hook.URL, hook.Config.URL, hook.LastResponse.Code, hook.LastResponse.Status)
+	}
+
+	// the metrics are served from the statuses once the cycle is complete
+	status := metrics.WebhookStatus{
+		Scope:         scope,
+		Repository:    repo.Name,
+		Selector:      repo.Selector,
+		Team:          strings.Join(repo.Teams, "|"),
+		Webhook:       hook.URL,
+		WebhookID:     strconv.Itoa(hook.ID),
+		Target:        hook.Config.URL,
+		Status:        hook.LastResponse.Status,
+		Code:          hook.LastResponse.Code,
+		CodeGroup:     metrics.ClassifyCodeGroup(hook.LastResponse.Code, hook.LastResponse.Status, hook.LastResponse.Message).Name,
+		FailureReason: metrics.ClassifyFailureReason(hook.LastResponse.Code, hook.LastResponse.Status, hook.LastResponse.Message),
+	}
+	m.mu.Lock()
+	m.statuses = append(m.statuses, status)
+	m.mu.Unlock()
+
+	// delivery history
+	if m.webhookConfig.CollectDeliveries {
+		deliveries := m.collectDeliveries(ctx, scope, repo.Name, hook)
+		if m.webhookConfig.Redelivery.Enabled {
+			m.trackRedeliveries(scope, repo.Name, hook, deliveries)
+		}
+	}
+}
 
-	// configure application from environment variables
-	ghAppInstallation, repoListConfig, webhookConfig, waitTime, repoRefreshWaitTime, err := configFromEnv()
+func main() {
+	configFile := flag.String("config", os.Getenv("GWM_CONFIG_FILE"), "Path to a YAML configuration file (environment variables override its values)")
+	flag.Parse()
+
+	// configure application from config file and environment variables
+	cfg, err := config.Load(*configFile)
 	if err != nil {
 		log.Errorln("Failed to create configuration")
 		log.Fatalln(err)
 	}
 
-	// get some installation details
-	if err := ghAppInstallation.GetDetails(); err != nil {
-		log.Errorln("Failed to get App Installation Details")
-		log.Fatalln(err)
+	if cfg.Debug {
+		log.SetLevel(log.DebugLevel)
 	}
 
-	// authenticate against GitHub as a GitHub app
-	if err := ghAppInstallation.RefreshToken(context.Background()); err != nil {
-		log.Errorln("Failed to get GH App Installation Token")
-		log.Fatalln(err)
-	}
+	// descriptive labels put on the metrics
+	metrics.Labels = cfg.Metrics.Labels
 
-	var repos []string
+	// groups of webhook responses exposed in the code_group label
+	if len(cfg.Metrics.CodeGroups) > 0 {
+		metrics.CodeGroups = nil
+		for _, cgConfig := range cfg.Metrics.CodeGroups {
+			cg, err := metrics.NewCodeGroup(cgConfig)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			metrics.CodeGroups = append(metrics.CodeGroups, cg)
+		}
+	}
 
-	// get list of repositories
-	repos, err = ghapi.GenerateRepoList(context.Background(), ghAppInstallation, repoListConfig)
+	client, err := newClient(&cfg.GitHub)
 	if err != nil {
-		log.Errorln("Failed to generate repo list")
+		log.Errorln("Failed to create GitHub API client")
 		log.Fatalln(err)
 	}
 
-	// Prepare Label Values for the Repo List Metric
+	// ctx is cancelled to abort all requests against GitHub, stop is closed to stop scheduling new checks
+	ctx, abort := context.WithCancel(context.Background())
+	defer abort()
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
 
-	teamSlugsStr := strings.Join(repoListConfig.FilterTeamSlugs, "|")
-	var includeFiltersStr string
-	var excludeFiltersStr string
-	if repoListConfig.IncludeRepositoryRegexp != nil {
-		includeFiltersStr = strings.Join(append(repoListConfig.IncludeRepositories, repoListConfig.IncludeRepositoryRegexp.String()), "|")
-	} else {
-		includeFiltersStr = strings.Join(repoListConfig.IncludeRepositories, "|")
-	}
-	if repoListConfig.ExcludeRepositoryRegexp != nil {
-		excludeFiltersStr = strings.Join(append(repoListConfig.ExcludeRepositories, repoListConfig.ExcludeRepositoryRegexp.String()), "|")
+	// expose metrics for Prometheus
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Metrics.Path, promhttp.Handler())
+	server := &http.Server{Addr: cfg.Server.ListenAddress, Handler: mux}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// reload the configuration on changes of the config file or SIGHUP
+	configHolder := newConfigHolder(*configFile, cfg)
+	go configHolder.watch(ctx)
+
+	// monitors are done once all their loops returned
+	done := make(chan struct{})
+	if ghApp, ok := client.Auth.(*ghapi.GitHubApp); ok {
+		// monitor all installations of the GitHub App, if no specific installation was configured
+		go func() {
+			watchInstallations(ctx, stop, ghApp, configHolder)
+			close(done)
+		}()
 	} else {
-		excludeFiltersStr = strings.Join(repoListConfig.ExcludeRepositories, "|")
-	}
-	// update list of repositories every now and then
-	go func(ctx context.Context, ghAppInstallation *ghapi.GitHubAppInstallation, waitTime time.Duration, repoListConfig *types.RepositoryConfig) {
-		for {
-			var err error
-			repos, err = ghapi.GenerateRepoList(ctx, ghAppInstallation, repoListConfig)
-			if err != nil {
-				log.Errorf("Failed to refresh list of repositories: %+v", err)
+		// start up in the background, so that signals are handled while the initial repository list is generated
+		go func() {
+			defer close(done)
+
+			// authenticate against GitHub
+			if err := authenticate(ctx, client); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Errorln("Failed to authenticate against GitHub")
+				log.Fatalln(err)
 			}
-			metrics.RepositoryListCount.WithLabelValues(teamSlugsStr, includeFiltersStr, excludeFiltersStr).Set(float64(len(repos)))
-			log.Infof("Refreshed Repository List: Found %d repositories -> Next refresh in %s...", len(repos), waitTime)
-			time.Sleep(waitTime)
-		}
-	}(context.Background(), ghAppInstallation, repoRefreshWaitTime, repoListConfig)
 
-	// continuously check webhook statuses for all repos
-	go func(ctx context.Context, ghAppInstallation *ghapi.GitHubAppInstallation, waitTime time.Duration, webhookConfig *types.WebhookConfig) {
-		for {
-			apiRate, err := ghAppInstallation.GetAPIRateLimit()
-			if err != nil {
-				log.Errorf("Failed to get Rate Limit data from API: %+v", err)
+			m := newMonitor(client, configHolder, false)
+			if err := m.start(ctx, stop); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Errorln("Failed to start monitoring")
+				log.Fatalln(err)
 			}
-			reset := time.Unix(apiRate.Reset, 0)
-			log.Infof("API Rate Limit Usage: %d/%d remaining, resets at %s", apiRate.Remaining, apiRate.Limit, reset)
-			metrics.APIRateLimitRemaining.WithLabelValues(ghAppInstallation.ParentApp.ID, ghAppInstallation.ID).Set(float64(apiRate.Remaining))
+			m.wait()
+		}()
+	}
 
-			checkWebhooks(ctx, ghAppInstallation, repos, webhookConfig)
-			log.Infof("Processed webhooks for %d repositories -> Next iteration in %s...", len(repos), waitTime)
-			time.Sleep(waitTime)
-		}
-	}(context.Background(), ghAppInstallation, waitTime, webhookConfig)
+	select {
+	case err := <-serverErr:
+		log.Fatalln(err)
+	case sig := <-signals:
+		log.Infof("Received %s, shutting down (waiting up to %s for in-flight checks)...", sig, cfg.Server.ShutdownTimeout)
+	}
+	shutdown(cfg.Server.ShutdownTimeout, server, stop, abort, done, signals)
+}
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// shutdown stops scheduling new checks and waits for the in-flight ones to finish within the timeout (or until another signal is received)
+// before aborting them. Finally, the HTTP server is shut down, letting running scrapes complete.
+func shutdown(timeout time.Duration, server *http.Server, stop chan struct{}, abort context.CancelFunc, done <-chan struct{}, signals <-chan os.Signal) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	close(stop)
+	select {
+	case <-done:
+		log.Infoln("Finished in-flight checks")
+	case <-deadline.C:
+		log.Warnf("In-flight checks didn't finish within %s, aborting them", timeout)
+	case sig := <-signals:
+		log.Warnf("Received %s again, aborting in-flight checks", sig)
+	}
+	abort()
+	<-done
 
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("Failed to shut down HTTP server: %+v", err)
+	}
+	log.Infoln("Shut down")
 }
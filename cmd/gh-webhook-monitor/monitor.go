@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/ghapi"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/metrics"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// monitor periodically checks the webhooks of all repositories accessible by a single client
+type monitor struct {
+	client *ghapi.Client
+	config *configHolder
+
+	// restrictIncludes limits the inclusion list to repositories owned by the client's organization (when monitoring multiple installations)
+	restrictIncludes bool
+
+	// snapshots of the current configuration, taken by the refresh and check loops respectively at the start of each iteration
+	repoListConfig *types.RepositoryConfig
+	webhookConfig  *types.WebhookConfig
+
+	// inventory holds the list of repositories refreshed by the refresh loop and checked by the check loop
+	inventory repoInventory
+
+	// reloaded is signalled by the refresh loop once the repository list was regenerated after a configuration change,
+	// so that the check loop checks the webhooks again with the new configuration and repository list
+	reloaded chan struct{}
+
+	// mu guards the state below while the webhooks of multiple repositories are checked concurrently
+	mu sync.Mutex
+
+	// statuses holds the statuses of the webhooks checked in the current cycle
+	statuses []metrics.WebhookStatus
+
+	// deliveryCursors holds the ID of the newest delivery seen per webhook
+	deliveryCursors map[hookKey]int64
+	seenHooks       map[hookKey]bool
+
+	// pendingRedeliveries holds the failed deliveries considered for redelivery by their GUID
+	pendingRedeliveries map[string]*pendingRedelivery
+
+	// hookSeries and repoSeries track the metric series set per webhook (hookKey) and per repository,
+	// so that they're deleted once the webhook or repository is gone
+	hookSeries seriesTracker
+	repoSeries seriesTracker
+
+	// repoListSeries are the label values of the current series of the repo list metric
+	repoListSeries []string
+
+	// loops tracks the background loops started by start
+	loops sync.WaitGroup
+}
+
+// newMonitor creates a monitor for the given client
+func newMonitor(client *ghapi.Client, config *configHolder, restrictIncludes bool) *monitor {
+	return &monitor{
+		client:              client,
+		config:              config,
+		restrictIncludes:    restrictIncludes,
+		deliveryCursors:     map[hookKey]int64{},
+		seenHooks:           map[hookKey]bool{},
+		pendingRedeliveries: map[string]*pendingRedelivery{},
+		reloaded:            make(chan struct{}, 1),
+	}
+}
+
+// labelValues prefixes the given label values with the organization and installation ID of the monitor's client
+func (m *monitor) labelValues(values ...string) []string {
+	return append([]string{m.client.Organization, m.client.InstallationID()}, values...)
+}
+
+// loadRepoListConfig takes a snapshot of the current repository configuration
+func (m *monitor) loadRepoListConfig() {
+	m.repoListConfig = &m.config.get().Repositories
+	if m.restrictIncludes {
+		m.repoListConfig = repoListConfigForOrganization(m.repoListConfig, m.client.Organization)
+	}
+}
+
+// loadWebhookConfig takes a snapshot of the current webhook configuration
+func (m *monitor) loadWebhookConfig() {
+	m.webhookConfig = &m.config.get().Webhooks
+}
+
+// repoListLabelValues prepares the label values for the repo list metric from the repository configuration the list was generated from
+func (m *monitor) repoListLabelValues(config *types.RepositoryConfig) []string {
+	if !metrics.Labels.RepositoryFilters {
+		return m.labelValues("", "", "")
+	}
+	teamSlugsStr := strings.Join(config.FilterTeamSlugs, "|")
+	var includeFiltersStr string
+	var excludeFiltersStr string
+	if config.IncludeRepositoryRegexp != nil {
+		includeFiltersStr = strings.Join(append(config.IncludeRepositories, config.IncludeRepositoryRegexp.String()), "|")
+	} else {
+		includeFiltersStr = strings.Join(config.IncludeRepositories, "|")
+	}
+	if config.ExcludeRepositoryRegexp != nil {
+		excludeFiltersStr = strings.Join(append(config.ExcludeRepositories, config.ExcludeRepositoryRegexp.String()), "|")
+	} else {
+		excludeFiltersStr = strings.Join(config.ExcludeRepositories, "|")
+	}
+	return m.labelValues(teamSlugsStr, includeFiltersStr, excludeFiltersStr)
+}
+
+// refreshRepoList generates the list of repositories from the current configuration and swaps it into the inventory.
+// On failure, the inventory keeps the last good list.
+func (m *monitor) refreshRepoList(ctx context.Context) error {
+	m.loadRepoListConfig()
+	repos, skipped, err := ghapi.GenerateRepoList(ctx, m.client, m.repoListConfig)
+	if err != nil {
+		return err
+	}
+	m.inventory.update(repos, skipped, m.repoListConfig)
+	log.Infof("Refreshed Repository List for org '%s': Found %d repositories", m.client.Organization, len(repos))
+	return nil
+}
+
+// start generates the initial list of repositories and starts refreshing it and checking the webhooks in the background.
+// The loops don't start new iterations once stop is closed and abort running ones when ctx is cancelled; use wait to wait for them to return.
+// Both loops pick up configuration changes: the repository list is regenerated right away and the webhooks are checked again once it is.
+func (m *monitor) start(ctx context.Context, stop <-chan struct{}) error {
+	// configuration changes from now on are picked up by the refresh loop, even if they happen while the list is generated
+	changes := m.config.changes()
+
+	// get list of repositories
+	if err := m.refreshRepoList(ctx); err != nil {
+		return fmt.Errorf("Failed to generate repo list for org '%s': %w", m.client.Organization, err)
+	}
+	if isStopped(ctx, stop) {
+		return nil
+	}
+
+	m.loops.Add(2)
+
+	// update list of repositories every now and then
+	go func(ctx context.Context) {
+		defer m.loops.Done()
+
+		waitTime := m.config.get().Intervals.RepoRefresh
+		ticker := time.NewTicker(waitTime)
+		defer ticker.Stop()
+
+		for {
+			inventory := m.inventory.snapshot()
+
+			// Label Values for the Repo List Metric
+			if series := m.repoListLabelValues(inventory.config); !reflect.DeepEqual(series, m.repoListSeries) {
+				if m.repoListSeries != nil {
+					metrics.RepositoryListCount.DeleteLabelValues(m.repoListSeries...)
+				}
+				m.repoListSeries = series
+			}
+			metrics.RepositoryListCount.WithLabelValues(m.repoListSeries...).Set(float64(len(inventory.repos)))
+			for _, reason := range ghapi.REPO_SKIP_REASONS {
+				metrics.RepositorySkippedCount.WithLabelValues(m.labelValues(reason)...).Set(float64(inventory.skipped[reason]))
+			}
+			metrics.RepositoryListLastRefreshTimestamp.WithLabelValues(m.labelValues()...).Set(float64(inventory.refreshedAt.Unix()))
+
+			waitTime = resetTicker(ticker, waitTime, m.config.get().Intervals.RepoRefresh)
+			log.Infof("Repository List for org '%s' has %d repositories -> Next refresh in %s...", m.client.Organization, len(inventory.repos), waitTime)
+
+			reloaded := false
+			select {
+			case <-stop:
+			case <-ctx.Done():
+			case <-changes:
+				reloaded = true
+			case <-ticker.C:
+			}
+			if isStopped(ctx, stop) {
+				return
+			}
+
+			changes = m.config.changes()
+			if err := m.refreshRepoList(ctx); err != nil {
+				log.Errorf("Failed to refresh list of repositories for org '%s', keeping the list from %s: %+v", m.client.Organization, inventory.refreshedAt.Format(time.RFC3339), err)
+			}
+
+			// let the check loop pick up the new configuration (the signal is kept, if it's still busy with a check)
+			if reloaded {
+				select {
+				case m.reloaded <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}(ctx)
+
+	// continuously check webhook statuses for all repos
+	go func(ctx context.Context) {
+		defer m.loops.Done()
+
+		waitTime := m.config.get().Intervals.Wait
+		ticker := time.NewTicker(waitTime)
+		defer ticker.Stop()
+
+		for {
+			apiRate, err := m.client.GetAPIRateLimit(ctx)
+			if err != nil {
+				log.Errorf("Failed to get Rate Limit data from API: %+v", err)
+			}
+			reset := time.Unix(apiRate.Reset, 0)
+			log.Infof("API Rate Limit Usage for org '%s': %d/%d remaining, resets at %s", m.client.Organization, apiRate.Remaining, apiRate.Limit, reset)
+			metrics.APIRateLimitRemaining.WithLabelValues(m.client.AppID(), m.client.InstallationID(), m.client.Organization).Set(float64(apiRate.Remaining))
+
+			repos := m.inventory.snapshot().repos
+			m.loadWebhookConfig()
+			m.checkWebhooks(ctx, repos)
+
+			waitTime = resetTicker(ticker, waitTime, m.config.get().Intervals.Wait)
+			log.Infof("Processed webhooks for %d repositories of org '%s' -> Next iteration in %s...", len(repos), m.client.Organization, waitTime)
+
+			select {
+			case <-stop:
+			case <-ctx.Done():
+			case <-m.reloaded:
+			case <-ticker.C:
+			}
+			if isStopped(ctx, stop) {
+				return
+			}
+		}
+	}(ctx)
+
+	return nil
+}
+
+// wait blocks until the loops started by start have returned
+func (m *monitor) wait() {
+	m.loops.Wait()
+}
+
+// deleteSeries deletes all metric series of the monitor, once its loops returned.
+// This is only done when the installation is no longer monitored; on shutdown, the series are kept, so that a last scrape can complete.
+func (m *monitor) deleteSeries() {
+	metrics.RepositoryListCount.DeleteLabelValues(m.repoListSeries...)
+	for _, reason := range ghapi.REPO_SKIP_REASONS {
+		metrics.RepositorySkippedCount.DeleteLabelValues(m.labelValues(reason)...)
+	}
+	metrics.RepositoryListLastRefreshTimestamp.DeleteLabelValues(m.labelValues()...)
+	metrics.WebhookStatuses.Remove(m.client.Organization, m.client.InstallationID())
+	m.hookSeries.prune(func(interface{}) bool { return false })
+	m.repoSeries.prune(func(interface{}) bool { return false })
+	metrics.CheckCycleDurationSeconds.DeleteLabelValues(m.labelValues()...)
+	metrics.RepositoryCheckDurationSeconds.DeleteLabelValues(m.labelValues()...)
+	metrics.APIRateLimitRemaining.DeleteLabelValues(m.client.AppID(), m.client.InstallationID(), m.client.Organization)
+	for _, reason := range []string{ghapi.RATE_LIMIT_WAIT_REASON_PACING, ghapi.RATE_LIMIT_WAIT_REASON_EXHAUSTED, ghapi.RATE_LIMIT_WAIT_REASON_RETRY_AFTER} {
+		metrics.APIRateLimitWaitSecondsTotal.DeleteLabelValues(m.labelValues(reason)...)
+	}
+}
+
+// isStopped tells whether a loop should return instead of starting a new iteration
+func isStopped(ctx context.Context, stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// resetTicker changes the interval of the ticker, if it differs from the current one, and returns the new interval
+func resetTicker(ticker *time.Ticker, current, interval time.Duration) time.Duration {
+	if interval != current {
+		ticker.Reset(interval)
+	}
+	return interval
+}
+
+// repoListConfigForOrganization returns a copy of the repository config which only includes repositories owned by the given organization,
+// so that an explicit inclusion list can be shared by all installations of a GitHub App
+func repoListConfigForOrganization(config *types.RepositoryConfig, org string) *types.RepositoryConfig {
+	orgConfig := *config
+	orgConfig.IncludeRepositories = []string{}
+	for _, repo := range config.IncludeRepositories {
+		if r, ok := ghapi.ValidateAndNormalizeRepositoryIdentifier(repo); ok && !strings.EqualFold(strings.Split(r, "/")[0], org) {
+			continue
+		}
+		orgConfig.IncludeRepositories = append(orgConfig.IncludeRepositories, repo)
+	}
+	return &orgConfig
+}
+
+// installationMonitor is a monitor started for an installation of the GitHub App
+type installationMonitor struct {
+	*monitor
+	cancel context.CancelFunc
+}
+
+// watchInstallations periodically discovers the installations of the GitHub App and starts or stops a monitor for each of them.
+// Once stop is closed, it waits for the monitors of all installations to return.
+func watchInstallations(ctx context.Context, stop <-chan struct{}, ghApp *ghapi.GitHubApp, config *configHolder) {
+	monitors := map[string]installationMonitor{}
+	defer func() {
+		for _, im := range monitors {
+			im.wait()
+			im.cancel()
+		}
+	}()
+
+	installationRefreshWaitTime := config.get().Intervals.InstallationRefresh
+	ticker := time.NewTicker(installationRefreshWaitTime)
+	defer ticker.Stop()
+
+	for {
+		installationRefreshWaitTime = resetTicker(ticker, installationRefreshWaitTime, config.get().Intervals.InstallationRefresh)
+
+		installations, err := ghApp.GetInstallations(ctx)
+		if err != nil {
+			log.Errorf("Failed to list installations of GitHub App '%s': %+v", ghApp.ID, err)
+		} else {
+			found := map[string]bool{}
+			for _, installation := range installations {
+				installationID := strconv.Itoa(installation.ID)
+				if installation.SuspendedAt != nil {
+					log.Debugf("Skipping suspended installation '%s' (org '%s')", installationID, installation.Account.Login)
+					continue
+				}
+				found[installationID] = true
+
+				if _, running := monitors[installationID]; running {
+					continue
+				}
+
+				log.Infof("Found new installation '%s' of GitHub App '%s' in org '%s'", installationID, ghApp.ID, installation.Account.Login)
+				client := &ghapi.Client{
+					Auth: &ghapi.GitHubAppInstallation{
+						ID:           installationID,
+						Organization: installation.Account.Login,
+						ParentApp:    ghApp,
+						Endpoints:    ghApp.Endpoints,
+					},
+					Organization: installation.Account.Login,
+				}
+
+				if err := authenticate(ctx, client); err != nil {
+					log.Errorf("Failed to authenticate as installation '%s' (will retry in %s): %+v", installationID, installationRefreshWaitTime, err)
+					continue
+				}
+
+				m := newMonitor(client, config, true)
+
+				monitorCtx, cancel := context.WithCancel(ctx)
+				if err := m.start(monitorCtx, stop); err != nil {
+					cancel()
+					log.Errorf("Failed to start monitoring installation '%s' (will retry in %s): %+v", installationID, installationRefreshWaitTime, err)
+					continue
+				}
+				monitors[installationID] = installationMonitor{monitor: m, cancel: cancel}
+			}
+
+			// stop monitoring installations that were removed or suspended
+			for installationID, im := range monitors {
+				if !found[installationID] {
+					log.Infof("Installation '%s' of GitHub App '%s' is gone, stopping to monitor it", installationID, ghApp.ID)
+					im.cancel()
+					im.wait()
+					im.deleteSeries()
+					delete(monitors, installationID)
+				}
+			}
+
+			metrics.AppInstallationsCount.WithLabelValues(ghApp.ID).Set(float64(len(monitors)))
+			log.Infof("Monitoring %d installations of GitHub App '%s' -> Next discovery in %s...", len(monitors), ghApp.ID, installationRefreshWaitTime)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/ghapi"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/metrics"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// pendingRedelivery is a failed webhook delivery which is considered for redelivery
+type pendingRedelivery struct {
+	scope            string
+	repo             string
+	hook             ghapi.GHAPIResponseHook
+	deliveryID       int64 // ID of the most recent failed attempt
+	event            string
+	firstDeliveredAt time.Time
+	attempts         int
+	awaitingResult   bool // a redelivery was requested, but its result didn't show up in the deliveries yet
+}
+
+func (p *pendingRedelivery) labelValues(m *monitor, values ...string) []string {
+	return m.labelValues(append([]string{p.scope, p.repo, strconv.Itoa(p.hook.ID), metrics.TargetLabel(p.hook.Config.URL), p.event}, values...)...)
+}
+
+// hookKey identifies the webhook of the delivery
+func (p *pendingRedelivery) hookKey() hookKey {
+	return hookKey{scope: p.scope, repo: p.repo, id: p.hook.ID}
+}
+
+// count increments the series of the counter for the delivery with the given label values
+func (p *pendingRedelivery) count(m *monitor, vec *prometheus.CounterVec, values ...string) {
+	vec.WithLabelValues(m.hookSeries.track(p.hookKey(), vec, p.labelValues(m, values...))...).Inc()
+}
+
+// isFailedDelivery tells whether a delivery did not reach its target successfully
+func isFailedDelivery(delivery ghapi.GHAPIResponseHookDelivery) bool {
+	return delivery.StatusCode < 200 || delivery.StatusCode > 299
+}
+
+// trackRedeliveries updates the pending redeliveries with the new deliveries of a webhook (sorted newest first)
+func (m *monitor) trackRedeliveries(scope, repo string, hook ghapi.GHAPIResponseHook, deliveries []ghapi.GHAPIResponseHookDelivery) {
+	policy := m.webhookConfig.Redelivery
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// walk from oldest to newest, so that the latest attempt of a delivery wins
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		delivery := deliveries[i]
+		pending, exists := m.pendingRedeliveries[delivery.GUID]
+
+		if !isFailedDelivery(delivery) {
+			if exists {
+				log.Infof("Redelivery of delivery '%s' (event '%s') to '%s' succeeded after %d attempt(s)", delivery.GUID, delivery.Event, hook.Config.URL, pending.attempts)
+				pending.count(m, metrics.WebhookRedeliveriesCompletedTotal, "succeeded")
+				delete(m.pendingRedeliveries, delivery.GUID)
+			}
+			continue
+		}
+
+		if exists {
+			// a redelivery failed again
+			pending.deliveryID = delivery.ID
+			pending.awaitingResult = false
+			continue
+		}
+
+		if !policy.Matches(delivery.Event, hook.Config.URL) {
+			continue
+		}
+
+		log.Debugf("Delivery '%s' (event '%s') to '%s' failed with status code %d, considering it for redelivery", delivery.GUID, delivery.Event, hook.Config.URL, delivery.StatusCode)
+		m.pendingRedeliveries[delivery.GUID] = &pendingRedelivery{
+			scope:            scope,
+			repo:             repo,
+			hook:             hook,
+			deliveryID:       delivery.ID,
+			event:            delivery.Event,
+			firstDeliveredAt: delivery.DeliveredAt,
+		}
+	}
+}
+
+// processRedeliveries requests the redelivery of all pending failed deliveries which are due according to the redelivery policy
+func (m *monitor) processRedeliveries(ctx context.Context) {
+	policy := m.webhookConfig.Redelivery
+	now := time.Now()
+
+	for guid, pending := range m.pendingRedeliveries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		age := now.Sub(pending.firstDeliveredAt)
+
+		if age > policy.MaxAge {
+			log.Warnf("Giving up on redelivering delivery '%s' (event '%s') to '%s': older than %s", guid, pending.event, pending.hook.Config.URL, policy.MaxAge)
+			pending.count(m, metrics.WebhookRedeliveriesCompletedTotal, "expired")
+			delete(m.pendingRedeliveries, guid)
+			continue
+		}
+
+		if pending.awaitingResult || age < policy.MinAge {
+			continue
+		}
+
+		if pending.attempts >= policy.MaxAttempts {
+			log.Warnf("Giving up on redelivering delivery '%s' (event '%s') to '%s': %d attempt(s) failed", guid, pending.event, pending.hook.Config.URL, pending.attempts)
+			pending.count(m, metrics.WebhookRedeliveriesCompletedTotal, "budget_exhausted")
+			delete(m.pendingRedeliveries, guid)
+			continue
+		}
+
+		// a dry run doesn't use up the budget of attempts: the delivery is counted once and no longer considered
+		if policy.DryRun {
+			log.Infof("[DRY RUN] Would redeliver delivery '%s' (event '%s') to '%s'", guid, pending.event, pending.hook.Config.URL)
+			pending.count(m, metrics.WebhookRedeliveryAttemptsTotal, "dry_run")
+			pending.count(m, metrics.WebhookRedeliveriesCompletedTotal, "dry_run")
+			delete(m.pendingRedeliveries, guid)
+			continue
+		}
+
+		pending.attempts++
+
+		var err error
+		if pending.scope == types.WEBHOOK_SCOPE_ORG {
+			err = m.client.RedeliverOrgHookDelivery(ctx, pending.hook.ID, pending.deliveryID)
+		} else {
+			err = m.client.RedeliverRepoHookDelivery(ctx, pending.repo, pending.hook.ID, pending.deliveryID)
+		}
+		if err != nil {
+			log.Errorf("Failed to redeliver delivery '%s' (event '%s') to '%s' (attempt %d/%d)\n%+v", guid, pending.event, pending.hook.Config.URL, pending.attempts, policy.MaxAttempts, err)
+			pending.count(m, metrics.WebhookRedeliveryAttemptsTotal, "error")
+			continue
+		}
+
+		log.Infof("Requested redelivery of delivery '%s' (event '%s') to '%s' (attempt %d/%d)", guid, pending.event, pending.hook.Config.URL, pending.attempts, policy.MaxAttempts)
+		pending.count(m, metrics.WebhookRedeliveryAttemptsTotal, "requested")
+		pending.awaitingResult = true
+	}
+}
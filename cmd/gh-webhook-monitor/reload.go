@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/config"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/metrics"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// configFilePollInterval is the interval in which the configuration file is checked for changes
+const configFilePollInterval = 10 * time.Second
+
+// configHolder holds the current configuration, which can be swapped at runtime by reloading the configuration file
+type configHolder struct {
+	file string
+
+	mu       sync.RWMutex
+	current  *types.Config
+	changed  chan struct{} // closed and replaced on every successful reload
+	lastFile []byte        // content of the configuration file at the last (attempted) reload
+}
+
+// newConfigHolder creates a holder for the given initial configuration, which was loaded from file (may be empty)
+func newConfigHolder(file string, cfg *types.Config) *configHolder {
+	h := &configHolder{
+		file:    file,
+		current: cfg,
+		changed: make(chan struct{}),
+	}
+	if file != "" {
+		h.lastFile, _ = ioutil.ReadFile(file)
+	}
+	metrics.ConfigReloadSuccess.Set(1)
+	metrics.ConfigLastReloadTimestamp.SetToCurrentTime()
+	return h
+}
+
+// get returns the current configuration, which must not be modified
+func (h *configHolder) get() *types.Config {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.current
+}
+
+// changes returns a channel which is closed the next time the configuration changes
+func (h *configHolder) changes() <-chan struct{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.changed
+}
+
+// reload loads and validates the configuration again and swaps it in, if it is valid.
+// Settings which can't be changed at runtime (GitHub, metrics and server) are kept.
+func (h *configHolder) reload() {
+	cfg, err := config.Load(h.file)
+	if err != nil {
+		log.Errorf("Failed to reload configuration, keeping the current one: %+v", err)
+		metrics.ConfigReloadSuccess.Set(0)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !reflect.DeepEqual(cfg.GitHub, h.current.GitHub) || !reflect.DeepEqual(cfg.Metrics, h.current.Metrics) || cfg.Server != h.current.Server {
+		log.Warnln("Changes to the 'github', 'metrics' and 'server' settings require a restart and are ignored")
+		cfg.GitHub = h.current.GitHub
+		cfg.Metrics = h.current.Metrics
+		cfg.Server = h.current.Server
+	}
+
+	if cfg.Debug {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+	}
+
+	h.current = cfg
+	close(h.changed)
+	h.changed = make(chan struct{})
+
+	metrics.ConfigReloadSuccess.Set(1)
+	metrics.ConfigLastReloadTimestamp.SetToCurrentTime()
+	log.Infoln("Reloaded configuration")
+}
+
+// watch reloads the configuration on SIGHUP and whenever the content of the configuration file changes
+func (h *configHolder) watch(ctx context.Context) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	ticker := time.NewTicker(configFilePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			log.Infoln("Received SIGHUP, reloading configuration...")
+			h.reload()
+		case <-ticker.C:
+			if h.file == "" {
+				continue
+			}
+			// polling the content instead of watching for file events also catches Kubernetes ConfigMap updates (symlink swaps)
+			content, err := ioutil.ReadFile(h.file)
+			if err != nil {
+				log.Errorf("Failed to read config file '%s': %+v", h.file, err)
+				continue
+			}
+			if bytes.Equal(content, h.lastFile) {
+				continue
+			}
+			h.lastFile = content
+			log.Infof("Config file '%s' changed, reloading configuration...", h.file)
+			h.reload()
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// seriesDeleter is implemented by all metric vectors
+type seriesDeleter interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// trackedSeries is a series of a metric vector
+type trackedSeries struct {
+	vec         seriesDeleter
+	labelValues []string
+}
+
+// seriesTracker remembers the series set for an owner (e.g. a webhook or a repository), so that they can be deleted once the owner is gone
+type seriesTracker struct {
+	mu     sync.Mutex
+	series map[interface{}]map[string]trackedSeries // by owner and joined label values
+}
+
+// track remembers the series of the vector for the owner and returns its label values
+func (tracker *seriesTracker) track(owner interface{}, vec seriesDeleter, labelValues []string) []string {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if tracker.series == nil {
+		tracker.series = map[interface{}]map[string]trackedSeries{}
+	}
+	if tracker.series[owner] == nil {
+		tracker.series[owner] = map[string]trackedSeries{}
+	}
+	tracker.series[owner][strings.Join(labelValues, "\x00")] = trackedSeries{vec: vec, labelValues: labelValues}
+	return labelValues
+}
+
+// prune deletes the series of all owners which are not kept
+func (tracker *seriesTracker) prune(keep func(owner interface{}) bool) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	for owner, series := range tracker.series {
+		if keep(owner) {
+			continue
+		}
+		for _, s := range series {
+			s.vec.DeleteLabelValues(s.labelValues...)
+		}
+		delete(tracker.series, owner)
+	}
+}
@@ -7,4 +7,5 @@ require (
 	github.com/prometheus/client_golang v1.7.1
 	github.com/sirupsen/logrus v1.6.0
 	golang.org/x/sys v0.0.0-20200915084602-288bc346aa39 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,465 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/ghapi"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/metrics"
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+	"gopkg.in/yaml.v2"
+)
+
+// Default returns the configuration used if nothing else is configured
+func Default() *types.Config {
+	return &types.Config{
+		GitHub: types.GitHubConfig{
+			PerPage:  ghapi.DEFAULT_PAGINATION_PER_PAGE,
+			MaxPages: ghapi.DEFAULT_PAGINATION_MAX_PAGES,
+
+			MaxConcurrentRequests: ghapi.DEFAULT_MAX_CONCURRENT_REQUESTS,
+			RateLimitBudget:       ghapi.DEFAULT_RATE_LIMIT_BUDGET,
+			MaxRetries:            ghapi.DEFAULT_RETRY_MAX_RETRIES,
+			RetryBackoff:          ghapi.DEFAULT_RETRY_INITIAL_BACKOFF,
+			RequestTimeout:        ghapi.DEFAULT_REQUEST_TIMEOUT,
+		},
+		Intervals: types.IntervalConfig{
+			Wait:                types.DEFAULT_WAIT_TIME,
+			RepoRefresh:         types.DEFAULT_REPO_REFRESH_WAIT_TIME,
+			InstallationRefresh: types.DEFAULT_INSTALLATION_REFRESH_WAIT_TIME,
+		},
+		Repositories: types.RepositoryConfig{
+			Discovery: types.RepositoryDiscoveryConfig{
+				IncludeForks: true,
+			},
+		},
+		Webhooks: types.WebhookConfig{
+			Workers: types.DEFAULT_WEBHOOK_WORKERS,
+			Redelivery: types.RedeliveryConfig{
+				MaxAge:      types.DEFAULT_REDELIVERY_MAX_AGE,
+				MaxAttempts: types.DEFAULT_REDELIVERY_MAX_ATTEMPTS,
+			},
+		},
+		Metrics: types.MetricsConfig{
+			Path: types.DEFAULT_METRICS_PATH,
+			Labels: types.MetricsLabelsConfig{
+				Webhook:           true,
+				Target:            types.METRICS_TARGET_LABEL_FULL,
+				Status:            types.METRICS_STATUS_LABEL_RAW,
+				RepositoryFilters: true,
+			},
+		},
+		Server: types.ServerConfig{
+			ListenAddress:   types.DEFAULT_LISTEN_ADDRESS,
+			ShutdownTimeout: types.DEFAULT_SHUTDOWN_TIMEOUT,
+		},
+	}
+}
+
+// Load reads the configuration from the given YAML file (optional) and the environment, with environment variables
+// overriding values from the file, and validates it
+func Load(file string) (*types.Config, error) {
+	config := Default()
+
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read config file '%s': %w", file, err)
+		}
+		if err := yaml.UnmarshalStrict(data, config); err != nil {
+			return nil, fmt.Errorf("Failed to parse config file '%s': %w", file, err)
+		}
+	}
+
+	if err := FromEnv(config); err != nil {
+		return nil, err
+	}
+
+	if err := Validate(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// FromEnv overrides the given configuration with the values set in environment variables
+func FromEnv(config *types.Config) error {
+	// GitHub API & authentication
+	envString(&config.GitHub.APIBaseURL, "GWM_GH_API_BASE_URL")
+	envString(&config.GitHub.UploadURL, "GWM_GH_API_UPLOAD_URL")
+	envString(&config.GitHub.GraphQLURL, "GWM_GH_API_GRAPHQL_URL")
+	envString(&config.GitHub.Organization, "GWM_GH_ORG")
+	envString(&config.GitHub.App.ID, "GWM_GH_APP_ID")
+	envString(&config.GitHub.App.PemFile, "GWM_GH_APP_PEM")
+	envString(&config.GitHub.App.InstallationID, "GWM_GH_APP_INST_ID")
+	envString(&config.GitHub.Token, "GWM_GH_TOKEN")
+	envString(&config.GitHub.TokenFile, "GWM_GH_TOKEN_FILE")
+	if err := envInt(&config.GitHub.PerPage, "GWM_GH_API_PER_PAGE"); err != nil {
+		return err
+	}
+	if err := envInt(&config.GitHub.MaxPages, "GWM_GH_API_MAX_PAGES"); err != nil {
+		return err
+	}
+	if err := envInt(&config.GitHub.MaxConcurrentRequests, "GWM_GH_API_MAX_CONCURRENT_REQUESTS"); err != nil {
+		return err
+	}
+	if err := envFloat(&config.GitHub.RateLimitBudget, "GWM_GH_API_RATE_LIMIT_BUDGET"); err != nil {
+		return err
+	}
+	if err := envInt(&config.GitHub.MaxRetries, "GWM_GH_API_MAX_RETRIES"); err != nil {
+		return err
+	}
+	if err := envDuration(&config.GitHub.RetryBackoff, "GWM_GH_API_RETRY_BACKOFF"); err != nil {
+		return err
+	}
+	if err := envDuration(&config.GitHub.RequestTimeout, "GWM_GH_API_REQUEST_TIMEOUT"); err != nil {
+		return err
+	}
+
+	// Intervals
+	if err := envDuration(&config.Intervals.Wait, "GWM_WAIT_TIME"); err != nil {
+		return err
+	}
+	if err := envDuration(&config.Intervals.RepoRefresh, "GWM_REPO_REFRESH_WAIT_TIME"); err != nil {
+		return err
+	}
+	if err := envDuration(&config.Intervals.InstallationRefresh, "GWM_INSTALLATION_REFRESH_WAIT_TIME"); err != nil {
+		return err
+	}
+
+	// Repository filters
+	envList(&config.Repositories.IncludeRepositories, "GWM_REPOS_INCLUDE")
+	envList(&config.Repositories.ExcludeRepositories, "GWM_REPOS_EXCLUDE")
+	envRegexp(&config.Repositories.IncludeRepositoryRegexp, "GWM_REPOS_INCLUDE_REGEXP")
+	envRegexp(&config.Repositories.ExcludeRepositoryRegexp, "GWM_REPOS_EXCLUDE_REGEXP")
+	envList(&config.Repositories.FilterTeamSlugs, "GWM_REPOS_FILTER_TEAM_SLUGS")
+	if err := envBool(&config.Repositories.IncludeChildTeams, "GWM_REPOS_FILTER_TEAM_INCLUDE_CHILDREN"); err != nil {
+		return err
+	}
+	envList(&config.Repositories.IncludeSelectors, "GWM_REPOS_INCLUDE_SELECTORS")
+	envList(&config.Repositories.ExcludeSelectors, "GWM_REPOS_EXCLUDE_SELECTORS")
+	if err := envBool(&config.Repositories.IncludeArchived, "GWM_REPOS_INCLUDE_ARCHIVED"); err != nil {
+		return err
+	}
+	if err := envBool(&config.Repositories.IncludeDisabled, "GWM_REPOS_INCLUDE_DISABLED"); err != nil {
+		return err
+	}
+
+	// Repository discovery
+	discovery := &config.Repositories.Discovery
+	if err := envBool(&discovery.Enabled, "GWM_REPOS_DISCOVER_ORG"); err != nil {
+		return err
+	}
+	envList(&discovery.Visibilities, "GWM_REPOS_DISCOVER_VISIBILITIES")
+	if err := envBool(&discovery.IncludeForks, "GWM_REPOS_DISCOVER_INCLUDE_FORKS"); err != nil {
+		return err
+	}
+	envList(&discovery.Languages, "GWM_REPOS_DISCOVER_LANGUAGES")
+
+	// Webhook filters
+	envRegexp(&config.Webhooks.FilterTargetURLRegexp, "GWM_WEBHOOKS_FILTER_TARGET_REGEXP")
+	envList(&config.Webhooks.Scopes, "GWM_WEBHOOKS_FILTER_SCOPES")
+	if err := envInt(&config.Webhooks.Workers, "GWM_WEBHOOKS_WORKERS"); err != nil {
+		return err
+	}
+	if err := envBool(&config.Webhooks.CollectDeliveries, "GWM_WEBHOOKS_COLLECT_DELIVERIES"); err != nil {
+		return err
+	}
+
+	// Redelivery
+	if err := envBool(&config.Webhooks.Redelivery.Enabled, "GWM_REDELIVERY_ENABLED"); err != nil {
+		return err
+	}
+	if err := envBool(&config.Webhooks.Redelivery.DryRun, "GWM_REDELIVERY_DRY_RUN"); err != nil {
+		return err
+	}
+	envList(&config.Webhooks.Redelivery.Events, "GWM_REDELIVERY_EVENTS")
+	envRegexp(&config.Webhooks.Redelivery.FilterTargetURLRegexp, "GWM_REDELIVERY_TARGET_REGEXP")
+	if err := envDuration(&config.Webhooks.Redelivery.MinAge, "GWM_REDELIVERY_MIN_AGE"); err != nil {
+		return err
+	}
+	if err := envDuration(&config.Webhooks.Redelivery.MaxAge, "GWM_REDELIVERY_MAX_AGE"); err != nil {
+		return err
+	}
+	if err := envInt(&config.Webhooks.Redelivery.MaxAttempts, "GWM_REDELIVERY_MAX_ATTEMPTS"); err != nil {
+		return err
+	}
+
+	// Metrics & Server
+	envString(&config.Metrics.Path, "GWM_METRICS_PATH")
+	if err := envBool(&config.Metrics.Labels.Webhook, "GWM_METRICS_LABEL_WEBHOOK"); err != nil {
+		return err
+	}
+	envString(&config.Metrics.Labels.Target, "GWM_METRICS_LABEL_TARGET")
+	envString(&config.Metrics.Labels.Status, "GWM_METRICS_LABEL_STATUS")
+	if err := envBool(&config.Metrics.Labels.RepositoryFilters, "GWM_METRICS_LABEL_REPO_FILTERS"); err != nil {
+		return err
+	}
+	envString(&config.Server.ListenAddress, "GWM_LISTEN_ADDRESS")
+	if err := envDuration(&config.Server.ShutdownTimeout, "GWM_SHUTDOWN_TIMEOUT"); err != nil {
+		return err
+	}
+
+	if os.Getenv("GWM_DEBUG") != "" {
+		config.Debug = true
+	}
+
+	return nil
+}
+
+// Validate checks the configuration for invalid values and compiles all regular expressions
+func Validate(config *types.Config) error {
+	// GitHub API & authentication
+	if config.GitHub.Token != "" || config.GitHub.TokenFile != "" {
+		if config.GitHub.Organization == "" {
+			return invalid("github.organization", "GWM_GH_ORG", "must be set when authenticating with a personal access token")
+		}
+	} else {
+		if config.GitHub.App.ID == "" {
+			return invalid("github.app.id", "GWM_GH_APP_ID", "must be set (or use a personal access token via 'github.token')")
+		}
+		if config.GitHub.App.PemFile == "" {
+			return invalid("github.app.pemFile", "GWM_GH_APP_PEM", "must be set (or use a personal access token via 'github.token')")
+		}
+	}
+	if config.GitHub.PerPage < 1 || config.GitHub.PerPage > 100 {
+		return invalid("github.perPage", "GWM_GH_API_PER_PAGE", fmt.Sprintf("must be a number between 1 and 100, got %d", config.GitHub.PerPage))
+	}
+	if config.GitHub.MaxPages < 0 {
+		return invalid("github.maxPages", "GWM_GH_API_MAX_PAGES", fmt.Sprintf("must not be negative, got %d", config.GitHub.MaxPages))
+	}
+	if config.GitHub.MaxConcurrentRequests < 1 || config.GitHub.MaxConcurrentRequests > ghapi.MAX_CONCURRENT_REQUESTS {
+		return invalid("github.maxConcurrentRequests", "GWM_GH_API_MAX_CONCURRENT_REQUESTS", fmt.Sprintf("must be a number between 1 and %d, got %d", ghapi.MAX_CONCURRENT_REQUESTS, config.GitHub.MaxConcurrentRequests))
+	}
+	if config.GitHub.RateLimitBudget <= 0 || config.GitHub.RateLimitBudget > 1 {
+		return invalid("github.rateLimitBudget", "GWM_GH_API_RATE_LIMIT_BUDGET", fmt.Sprintf("must be a fraction greater than 0 and at most 1, got %g", config.GitHub.RateLimitBudget))
+	}
+	if config.GitHub.MaxRetries < 0 {
+		return invalid("github.maxRetries", "GWM_GH_API_MAX_RETRIES", fmt.Sprintf("must not be negative, got %d", config.GitHub.MaxRetries))
+	}
+	if config.GitHub.RetryBackoff <= 0 {
+		return invalid("github.retryBackoff", "GWM_GH_API_RETRY_BACKOFF", fmt.Sprintf("must be positive, got %s", config.GitHub.RetryBackoff))
+	}
+	if config.GitHub.RequestTimeout <= 0 {
+		return invalid("github.requestTimeout", "GWM_GH_API_REQUEST_TIMEOUT", fmt.Sprintf("must be positive, got %s", config.GitHub.RequestTimeout))
+	}
+
+	// Intervals
+	if config.Intervals.Wait <= 0 {
+		return invalid("intervals.wait", "GWM_WAIT_TIME", fmt.Sprintf("must be positive, got %s", config.Intervals.Wait))
+	}
+	if config.Intervals.RepoRefresh <= 0 {
+		return invalid("intervals.repoRefresh", "GWM_REPO_REFRESH_WAIT_TIME", fmt.Sprintf("must be positive, got %s", config.Intervals.RepoRefresh))
+	}
+	if config.Intervals.InstallationRefresh <= 0 {
+		return invalid("intervals.installationRefresh", "GWM_INSTALLATION_REFRESH_WAIT_TIME", fmt.Sprintf("must be positive, got %s", config.Intervals.InstallationRefresh))
+	}
+
+	// Repository filters
+	for i, entry := range config.Repositories.IncludeRepositories {
+		if err := ghapi.ValidateRepositoryPattern(entry); err != nil {
+			return invalid(fmt.Sprintf("repositories.include[%d]", i), "GWM_REPOS_INCLUDE", err.Error())
+		}
+	}
+	for i, entry := range config.Repositories.ExcludeRepositories {
+		if err := ghapi.ValidateRepositoryPattern(entry); err != nil {
+			return invalid(fmt.Sprintf("repositories.exclude[%d]", i), "GWM_REPOS_EXCLUDE", err.Error())
+		}
+	}
+	if err := compileRegexp(&config.Repositories.IncludeRepositoryRegexp, "repositories.includeRegexp", "GWM_REPOS_INCLUDE_REGEXP"); err != nil {
+		return err
+	}
+	if err := compileRegexp(&config.Repositories.ExcludeRepositoryRegexp, "repositories.excludeRegexp", "GWM_REPOS_EXCLUDE_REGEXP"); err != nil {
+		return err
+	}
+
+	for i, selector := range config.Repositories.IncludeSelectors {
+		if err := ghapi.ValidateRepositorySelector(selector); err != nil {
+			return invalid(fmt.Sprintf("repositories.includeSelectors[%d]", i), "GWM_REPOS_INCLUDE_SELECTORS", err.Error())
+		}
+	}
+	for i, selector := range config.Repositories.ExcludeSelectors {
+		if err := ghapi.ValidateRepositorySelector(selector); err != nil {
+			return invalid(fmt.Sprintf("repositories.excludeSelectors[%d]", i), "GWM_REPOS_EXCLUDE_SELECTORS", err.Error())
+		}
+	}
+	for i, visibility := range config.Repositories.Discovery.Visibilities {
+		if visibility != types.REPO_VISIBILITY_PUBLIC && visibility != types.REPO_VISIBILITY_PRIVATE && visibility != types.REPO_VISIBILITY_INTERNAL {
+			return invalid(fmt.Sprintf("repositories.discovery.visibilities[%d]", i), "GWM_REPOS_DISCOVER_VISIBILITIES", fmt.Sprintf("unknown visibility '%s' (must be one of '%s', '%s', '%s')", visibility, types.REPO_VISIBILITY_PUBLIC, types.REPO_VISIBILITY_PRIVATE, types.REPO_VISIBILITY_INTERNAL))
+		}
+	}
+
+	// Webhook filters
+	if err := compileRegexp(&config.Webhooks.FilterTargetURLRegexp, "webhooks.targetRegexp", "GWM_WEBHOOKS_FILTER_TARGET_REGEXP"); err != nil {
+		return err
+	}
+	for i, scope := range config.Webhooks.Scopes {
+		if scope != types.WEBHOOK_SCOPE_REPO && scope != types.WEBHOOK_SCOPE_ORG {
+			return invalid(fmt.Sprintf("webhooks.scopes[%d]", i), "GWM_WEBHOOKS_FILTER_SCOPES", fmt.Sprintf("unknown webhook scope '%s' (must be one of '%s', '%s')", scope, types.WEBHOOK_SCOPE_REPO, types.WEBHOOK_SCOPE_ORG))
+		}
+	}
+	if config.Webhooks.Workers < 1 {
+		return invalid("webhooks.workers", "GWM_WEBHOOKS_WORKERS", fmt.Sprintf("must be a positive number, got %d", config.Webhooks.Workers))
+	}
+	if len(config.Webhooks.Scopes) == 0 {
+		config.Webhooks.Scopes = types.DEFAULT_WEBHOOK_SCOPES
+	}
+
+	// Redelivery
+	redelivery := &config.Webhooks.Redelivery
+	if err := compileRegexp(&redelivery.FilterTargetURLRegexp, "webhooks.redelivery.targetRegexp", "GWM_REDELIVERY_TARGET_REGEXP"); err != nil {
+		return err
+	}
+	if redelivery.MinAge < 0 {
+		return invalid("webhooks.redelivery.minAge", "GWM_REDELIVERY_MIN_AGE", fmt.Sprintf("must not be negative, got %s", redelivery.MinAge))
+	}
+	if redelivery.MaxAge <= redelivery.MinAge {
+		return invalid("webhooks.redelivery.maxAge", "GWM_REDELIVERY_MAX_AGE", fmt.Sprintf("must be greater than minAge (%s), got %s", redelivery.MinAge, redelivery.MaxAge))
+	}
+	if redelivery.MaxAttempts < 1 {
+		return invalid("webhooks.redelivery.maxAttempts", "GWM_REDELIVERY_MAX_ATTEMPTS", fmt.Sprintf("must be a positive number, got %d", redelivery.MaxAttempts))
+	}
+	if redelivery.Enabled {
+		// redelivery works on the collected deliveries
+		config.Webhooks.CollectDeliveries = true
+	}
+
+	// Metrics & Server
+	if !strings.HasPrefix(config.Metrics.Path, "/") {
+		return invalid("metrics.path", "GWM_METRICS_PATH", fmt.Sprintf("must start with '/', got '%s'", config.Metrics.Path))
+	}
+	switch config.Metrics.Labels.Target {
+	case types.METRICS_TARGET_LABEL_FULL, types.METRICS_TARGET_LABEL_HOST, types.METRICS_TARGET_LABEL_HASH, types.METRICS_TARGET_LABEL_NONE:
+	default:
+		return invalid("metrics.labels.target", "GWM_METRICS_LABEL_TARGET", fmt.Sprintf("must be one of '%s', '%s', '%s' or '%s', got '%s'", types.METRICS_TARGET_LABEL_FULL, types.METRICS_TARGET_LABEL_HOST, types.METRICS_TARGET_LABEL_HASH, types.METRICS_TARGET_LABEL_NONE, config.Metrics.Labels.Target))
+	}
+	switch config.Metrics.Labels.Status {
+	case types.METRICS_STATUS_LABEL_RAW, types.METRICS_STATUS_LABEL_NORMALIZED, types.METRICS_STATUS_LABEL_NONE:
+	default:
+		return invalid("metrics.labels.status", "GWM_METRICS_LABEL_STATUS", fmt.Sprintf("must be one of '%s', '%s' or '%s', got '%s'", types.METRICS_STATUS_LABEL_RAW, types.METRICS_STATUS_LABEL_NORMALIZED, types.METRICS_STATUS_LABEL_NONE, config.Metrics.Labels.Status))
+	}
+	for i := range config.Metrics.CodeGroups {
+		key := fmt.Sprintf("metrics.codeGroups[%d]", i)
+		if err := compileRegexp(&config.Metrics.CodeGroups[i].MessageRegexp, key+".messageRegexp", ""); err != nil {
+			return err
+		}
+		if _, err := metrics.NewCodeGroup(config.Metrics.CodeGroups[i]); err != nil {
+			return invalid(key, "", err.Error())
+		}
+	}
+	if config.Server.ListenAddress == "" {
+		return invalid("server.listenAddress", "GWM_LISTEN_ADDRESS", "must not be empty")
+	}
+	if config.Server.ShutdownTimeout <= 0 {
+		return invalid("server.shutdownTimeout", "GWM_SHUTDOWN_TIMEOUT", fmt.Sprintf("must be positive, got %s", config.Server.ShutdownTimeout))
+	}
+
+	return nil
+}
+
+// invalid creates an error pointing at the offending config key and its environment variable
+func invalid(key, envVar, msg string) error {
+	if envVar == "" {
+		// only available in the configuration file
+		return fmt.Errorf("Invalid value for config key '%s': %s", key, msg)
+	}
+	return fmt.Errorf("Invalid value for config key '%s' (env '%s'): %s", key, envVar, msg)
+}
+
+// compileRegexp compiles the regular expression in the given config field, dropping it if it's empty
+func compileRegexp(r **types.Regexp, key, envVar string) error {
+	if *r == nil {
+		return nil
+	}
+	if strings.TrimSpace((*r).Source) == "" {
+		*r = nil
+		return nil
+	}
+	if err := (*r).Compile(); err != nil {
+		return invalid(key, envVar, fmt.Sprintf("invalid regular expression '%s': %v", (*r).Source, err))
+	}
+	return nil
+}
+
+func envString(target *string, name string) {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		*target = value
+	}
+}
+
+// envList reads a comma-separated list from the environment
+func envList(target *[]string, name string) {
+	value := os.Getenv(name)
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*target = list
+}
+
+func envRegexp(target **types.Regexp, name string) {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		*target = &types.Regexp{Source: value}
+	}
+}
+
+func envBool(target *bool, name string) error {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("Failed to parse '%s' as boolean for %s", value, name)
+	}
+	*target = parsed
+	return nil
+}
+
+func envInt(target *int, name string) error {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("Failed to parse '%s' as number for %s", value, name)
+	}
+	*target = parsed
+	return nil
+}
+
+func envFloat(target *float64, name string) error {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("Failed to parse '%s' as number for %s", value, name)
+	}
+	*target = parsed
+	return nil
+}
+
+func envDuration(target *time.Duration, name string) error {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("Failed to parse '%s' to time.Duration format for %s", value, name)
+	}
+	*target = parsed
+	return nil
+}
@@ -1,12 +1,54 @@
 package ghapi
 
-import "net/http"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
 
 // DoAPIRequest does a request against the GitHub API and returns the response
-func (ghApp *GitHubApp) DoAPIRequest(method, path string) (*http.Response, error) {
-	appJWTToken, err := generateJWT(ghApp.ID, ghApp.PemFile)
+func (ghApp *GitHubApp) DoAPIRequest(ctx context.Context, method, path string) (*http.Response, error) {
+	return doAPIRequest(ctx, ghApp, method, path)
+}
+
+// GetInstallations lists all installations of the GitHub App
+func (ghApp *GitHubApp) GetInstallations(ctx context.Context) ([]GHAPIResponseInstallationDetails, error) {
+	installations := []GHAPIResponseInstallationDetails{}
+
+	err := doPaginatedAPIRequest(ctx, ghApp, http.MethodGet, "/app/installations", "", "app_installations", func(body []byte) error {
+		var page []GHAPIResponseInstallationDetails
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		installations = append(installations, page...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return doAPIRequest(method, path, appJWTToken)
+
+	return installations, nil
+}
+
+// AuthorizationHeader authenticates as the GitHub App itself using a freshly generated JWT
+func (ghApp *GitHubApp) AuthorizationHeader(ctx context.Context) (string, error) {
+	appJWTToken, err := generateJWT(ghApp.ID, ghApp.PemFile)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Bearer %s", appJWTToken), nil
+}
+
+// GetEndpoints returns the API endpoints of the GitHub instance the App lives on
+func (ghApp *GitHubApp) GetEndpoints() *GitHubEndpoints {
+	if ghApp.Endpoints != nil {
+		return ghApp.Endpoints
+	}
+	return &DefaultGitHubEndpoints
+}
+
+// GetRateLimiter returns the rate limiter tracking the quota of the App (JWT)
+func (ghApp *GitHubApp) GetRateLimiter() *RateLimiter {
+	return &ghApp.rateLimiter
 }
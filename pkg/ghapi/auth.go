@@ -1,6 +1,7 @@
 package ghapi
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -14,6 +15,27 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
+// Authenticator provides the credentials for requests against the GitHub API
+type Authenticator interface {
+	// AuthorizationHeader returns the value of the Authorization header to use for the next request
+	AuthorizationHeader(ctx context.Context) (string, error)
+	// GetEndpoints returns the API endpoints of the GitHub instance the credentials belong to
+	GetEndpoints() *GitHubEndpoints
+	// GetRateLimiter returns the rate limiter tracking the quota of the credentials
+	GetRateLimiter() *RateLimiter
+}
+
+// authLabelValues returns the organization and installation ID the credentials belong to, used to label metrics (empty if unknown, e.g. for the App itself)
+func authLabelValues(auth Authenticator) (string, string) {
+	switch a := auth.(type) {
+	case *GitHubAppInstallation:
+		return a.Organization, a.ID
+	case *PersonalAccessToken:
+		return a.Organization, ""
+	}
+	return "", ""
+}
+
 // generateJWT generates a new JSON Web Token out of the App's private pem
 func generateJWT(appID string, pemFile string) (string, error) {
 	pemReader, err := os.Open(pemFile)
@@ -49,9 +71,9 @@ func generateJWT(appID string, pemFile string) (string, error) {
 }
 
 // getAppInstallationToken requests an app installation token from GitHub
-func getAppInstallationToken(appToken, installationID string) (string, time.Time, error) {
+func getAppInstallationToken(ctx context.Context, endpoints *GitHubEndpoints, appToken, installationID string) (string, time.Time, error) {
 
-	ghURL, err := url.Parse(fmt.Sprintf("%s/app/installations/%s/access_tokens", GitHubAPIBaseURL, installationID))
+	ghURL, err := url.Parse(fmt.Sprintf("%s/app/installations/%s/access_tokens", endpoints.APIBaseURL, installationID))
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -65,7 +87,7 @@ func getAppInstallationToken(appToken, installationID string) (string, time.Time
 		},
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := doWithTimeout(ctx, req)
 	if err != nil {
 		return "", time.Time{}, err
 	}
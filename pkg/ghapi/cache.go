@@ -0,0 +1,143 @@
+package ghapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/metrics"
+)
+
+// cachedEndpoints are the list endpoints (as labelled in the metrics) whose responses are cached and requested conditionally.
+// Only endpoints with stable URLs are cached (e.g. not the deliveries, which are paginated by cursor).
+var cachedEndpoints = map[string]bool{
+	"repo_hooks":         true,
+	"org_hooks":          true,
+	"team_repos":         true,
+	"child_teams":        true,
+	"org_repos":          true,
+	"installation_repos": true,
+}
+
+// responseCache caches responses by credentials and URL, so that they can be requested conditionally (If-None-Match/If-Modified-Since).
+// GitHub doesn't count 304 Not Modified responses against the rate limit.
+type responseCache struct {
+	mu        sync.Mutex
+	entries   map[responseCacheKey]*responseCacheEntry
+	lastPrune time.Time
+}
+
+type responseCacheKey struct {
+	auth Authenticator
+	url  string
+}
+
+type responseCacheEntry struct {
+	etag         string
+	lastModified string
+	header       http.Header
+	body         []byte
+	lastUsed     time.Time
+}
+
+var cache = &responseCache{
+	entries: map[responseCacheKey]*responseCacheEntry{},
+}
+
+// conditionalHeaders returns the headers to request the given URL conditionally, if a response is cached for it
+func (c *responseCache) conditionalHeaders(auth Authenticator, url string) http.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[responseCacheKey{auth, url}]
+	if !ok {
+		return nil
+	}
+	header := http.Header{}
+	if entry.etag != "" {
+		header.Set("If-None-Match", entry.etag)
+	}
+	if entry.lastModified != "" {
+		header.Set("If-Modified-Since", entry.lastModified)
+	}
+	return header
+}
+
+// get returns the cached response for the given URL
+func (c *responseCache) get(auth Authenticator, url string) (*responseCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[responseCacheKey{auth, url}]
+	if ok {
+		entry.lastUsed = time.Now()
+	}
+	return entry, ok
+}
+
+// store caches a response, if it can be requested conditionally later on
+func (c *responseCache) store(auth Authenticator, url string, resp *http.Response, body []byte) {
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.entries[responseCacheKey{auth, url}] = &responseCacheEntry{
+		etag:         etag,
+		lastModified: lastModified,
+		header:       resp.Header,
+		body:         body,
+		lastUsed:     now,
+	}
+
+	// forget responses which weren't used for a while (e.g. of removed repositories)
+	if now.Sub(c.lastPrune) > responseCacheMaxAge {
+		for key, entry := range c.entries {
+			if now.Sub(entry.lastUsed) > responseCacheMaxAge {
+				delete(c.entries, key)
+			}
+		}
+		c.lastPrune = now
+	}
+}
+
+// doCachedAPIRequest does a conditional GET request for a cached endpoint and returns the response body and headers,
+// which are taken from the cache if the resource wasn't modified
+func doCachedAPIRequest(ctx context.Context, auth Authenticator, path, organization, endpoint string) ([]byte, http.Header, error) {
+	resp, err := doConditionalAPIRequest(ctx, auth, http.MethodGet, path, cache.conditionalHeaders(auth, path))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		if entry, ok := cache.get(auth, path); ok {
+			metrics.APICacheHitsTotal.WithLabelValues(organization, endpoint).Inc()
+			return entry.body, entry.header, nil
+		}
+
+		// the cached response was pruned in the meantime
+		resp.Body.Close()
+		resp, err = doAPIRequest(ctx, auth, http.MethodGet, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+	}
+	metrics.APICacheMissesTotal.WithLabelValues(organization, endpoint).Inc()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, newReadResponseError(path, err)
+	}
+	cache.store(auth, path, resp, body)
+
+	return body, resp.Header, nil
+}
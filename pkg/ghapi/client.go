@@ -0,0 +1,61 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// Client does requests against the GitHub API on behalf of a single organization
+type Client struct {
+	Auth         Authenticator
+	Organization string
+}
+
+// DoAPIRequest does a request against the GitHub API and returns the response
+func (client *Client) DoAPIRequest(ctx context.Context, method, path string) (*http.Response, error) {
+	return doAPIRequest(ctx, client.Auth, method, path)
+}
+
+// DoPaginatedAPIRequest requests all pages of a list endpoint and passes each page's body to handlePage
+func (client *Client) DoPaginatedAPIRequest(ctx context.Context, method, path, endpoint string, handlePage func(body []byte) error) error {
+	return doPaginatedAPIRequest(ctx, client.Auth, method, path, client.Organization, endpoint, handlePage)
+}
+
+// AppID returns the ID of the GitHub App the client authenticates as (empty for personal access tokens)
+func (client *Client) AppID() string {
+	if installation, ok := client.Auth.(*GitHubAppInstallation); ok {
+		return installation.ParentApp.ID
+	}
+	return ""
+}
+
+// InstallationID returns the ID of the GitHub App installation the client authenticates as (empty for personal access tokens)
+func (client *Client) InstallationID() string {
+	if installation, ok := client.Auth.(*GitHubAppInstallation); ok {
+		return installation.ID
+	}
+	return ""
+}
+
+// GetAPIRateLimit gets the current rate limit status of the client's credentials
+func (client *Client) GetAPIRateLimit(ctx context.Context) (GHAPIRate, error) {
+	resp, err := client.DoAPIRequest(ctx, http.MethodGet, "/rate_limit")
+	if err != nil {
+		return GHAPIRate{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return GHAPIRate{}, err
+	}
+
+	var response GHAPIResponseRateLimit
+	if err := json.Unmarshal(body, &response); err != nil {
+		return GHAPIRate{}, err
+	}
+
+	return response.Rate, nil
+}
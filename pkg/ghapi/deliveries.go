@@ -0,0 +1,66 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// GetRepoHookDeliveries lists the deliveries of a repository webhook which are newer than the delivery with the ID sinceID (newest first).
+// If sinceID is 0, only the most recent page of deliveries is returned.
+func (client *Client) GetRepoHookDeliveries(ctx context.Context, repo string, hookID int, sinceID int64) ([]GHAPIResponseHookDelivery, error) {
+	return client.getHookDeliveries(ctx, fmt.Sprintf("/repos/%s/hooks/%d/deliveries", repo, hookID), "repo_hook_deliveries", sinceID)
+}
+
+// GetOrgHookDeliveries lists the deliveries of an organization webhook which are newer than the delivery with the ID sinceID (newest first).
+// If sinceID is 0, only the most recent page of deliveries is returned.
+func (client *Client) GetOrgHookDeliveries(ctx context.Context, hookID int, sinceID int64) ([]GHAPIResponseHookDelivery, error) {
+	return client.getHookDeliveries(ctx, fmt.Sprintf("/orgs/%s/hooks/%d/deliveries", client.Organization, hookID), "org_hook_deliveries", sinceID)
+}
+
+func (client *Client) getHookDeliveries(ctx context.Context, path, endpoint string, sinceID int64) ([]GHAPIResponseHookDelivery, error) {
+	deliveries := []GHAPIResponseHookDelivery{}
+
+	err := client.DoPaginatedAPIRequest(ctx, http.MethodGet, path, endpoint, func(body []byte) error {
+		var page []GHAPIResponseHookDelivery
+		if err := json.Unmarshal(body, &page); err != nil {
+			return newUnmarshalResponseError(path, err)
+		}
+		for _, delivery := range page {
+			// deliveries are sorted newest first, so everything from here on was seen before
+			if delivery.ID <= sinceID {
+				return errStopPagination
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		if sinceID == 0 {
+			return errStopPagination
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RedeliverRepoHookDelivery requests the redelivery of a repository webhook delivery
+func (client *Client) RedeliverRepoHookDelivery(ctx context.Context, repo string, hookID int, deliveryID int64) error {
+	return client.redeliverHookDelivery(ctx, fmt.Sprintf("/repos/%s/hooks/%d/deliveries/%d/attempts", repo, hookID, deliveryID))
+}
+
+// RedeliverOrgHookDelivery requests the redelivery of an organization webhook delivery
+func (client *Client) RedeliverOrgHookDelivery(ctx context.Context, hookID int, deliveryID int64) error {
+	return client.redeliverHookDelivery(ctx, fmt.Sprintf("/orgs/%s/hooks/%d/deliveries/%d/attempts", client.Organization, hookID, deliveryID))
+}
+
+func (client *Client) redeliverHookDelivery(ctx context.Context, path string) error {
+	resp, err := client.DoAPIRequest(ctx, http.MethodPost, path)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,50 @@
+package ghapi
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GitHubEndpoints holds the URLs of the API endpoints of a GitHub (Enterprise Server) instance
+type GitHubEndpoints struct {
+	APIBaseURL    string // REST API, e.g. https://api.github.com or https://ghe.corp.example/api/v3
+	UploadBaseURL string // Uploads API, e.g. https://uploads.github.com or https://ghe.corp.example/api/uploads
+	GraphQLURL    string // GraphQL API, e.g. https://api.github.com/graphql or https://ghe.corp.example/api/graphql
+}
+
+// DefaultGitHubEndpoints are the endpoints of github.com
+var DefaultGitHubEndpoints = GitHubEndpoints{
+	APIBaseURL:    DEFAULT_GITHUB_API_BASE_URL,
+	UploadBaseURL: DEFAULT_GITHUB_UPLOAD_BASE_URL,
+	GraphQLURL:    DEFAULT_GITHUB_GRAPHQL_URL,
+}
+
+// NewGitHubEndpoints derives the API endpoints from the base URL of a GitHub instance.
+// For GitHub Enterprise Server, the base URL may be given with or without the /api/v3 suffix.
+func NewGitHubEndpoints(baseURL string) (*GitHubEndpoints, error) {
+	baseURL = strings.TrimSuffix(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		endpoints := DefaultGitHubEndpoints
+		return &endpoints, nil
+	}
+
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil || parsedURL.Host == "" || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return nil, fmt.Errorf("Invalid GitHub base URL '%s' (expected e.g. 'https://ghe.corp.example')", baseURL)
+	}
+
+	// github.com itself
+	if parsedURL.Host == "github.com" || parsedURL.Host == "api.github.com" {
+		endpoints := DefaultGitHubEndpoints
+		return &endpoints, nil
+	}
+
+	// GitHub Enterprise Server
+	root := strings.TrimSuffix(strings.TrimSuffix(baseURL, "/api/v3"), "/api")
+	return &GitHubEndpoints{
+		APIBaseURL:    root + "/api/v3",
+		UploadBaseURL: root + "/api/uploads",
+		GraphQLURL:    root + "/api/graphql",
+	}, nil
+}
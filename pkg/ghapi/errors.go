@@ -0,0 +1,133 @@
+package ghapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// Kinds of failed API requests, which can be checked with errors.Is
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrForbidden   = errors.New("forbidden (missing permission)")
+	ErrRateLimited = errors.New("rate limited")
+	ErrServerError = errors.New("server error")
+
+	ErrReadResponse      = errors.New("failed to read response body")
+	ErrUnmarshalResponse = errors.New("failed to unmarshal response body")
+)
+
+// APIError is returned for API requests which failed with a non-2xx status code
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string // message from the response body, if any
+	kind       error  // one of the Err* values above (nil for other client errors)
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("Request '%s %s' returned non-2xx status code (%d): %s", e.Method, e.URL, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("Request '%s %s' returned non-2xx status code (%d)", e.Method, e.URL, e.StatusCode)
+}
+
+// Unwrap makes the kind of the error available to errors.Is
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// ResponseError is returned if the body of a successful response couldn't be read or decoded
+type ResponseError struct {
+	Path string
+	Err  error // underlying error
+	kind error // ErrReadResponse or ErrUnmarshalResponse
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s of request '%s': %v", e.kind, e.Path, e.Err)
+}
+
+// Unwrap makes the kind of the error available to errors.Is
+func (e *ResponseError) Unwrap() error {
+	return e.kind
+}
+
+func newReadResponseError(path string, err error) *ResponseError {
+	return &ResponseError{Path: path, Err: err, kind: ErrReadResponse}
+}
+
+func newUnmarshalResponseError(path string, err error) *ResponseError {
+	return &ResponseError{Path: path, Err: err, kind: ErrUnmarshalResponse}
+}
+
+// newAPIError creates an error from a non-2xx response, reading and closing its body
+func newAPIError(req *http.Request, resp *http.Response) *APIError {
+	defer resp.Body.Close()
+
+	apiErr := &APIError{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+	}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024)); err == nil && json.Unmarshal(data, &body) == nil {
+		apiErr.Message = body.Message
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		apiErr.kind = ErrNotFound
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusForbidden && (resp.Header.Get("Retry-After") != "" || resp.Header.Get("X-RateLimit-Remaining") == "0"):
+		apiErr.kind = ErrRateLimited
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		apiErr.kind = ErrForbidden
+	case resp.StatusCode >= 500:
+		apiErr.kind = ErrServerError
+	}
+
+	return apiErr
+}
+
+// ErrorLabel returns the value of the 'error' metric label for an error returned by a request
+func ErrorLabel(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "notFound"
+	case errors.Is(err, ErrForbidden):
+		return "forbidden"
+	case errors.Is(err, ErrRateLimited):
+		return "rateLimited"
+	case errors.Is(err, ErrServerError):
+		return "serverError"
+	case errors.Is(err, ErrReadResponse):
+		return "readResponseError"
+	case errors.Is(err, ErrUnmarshalResponse):
+		return "unmarshalResponseBodyError"
+	default:
+		return "requestError"
+	}
+}
+
+// isRetryable tells whether a failed request may succeed if it's retried: server errors, rate limits, timeouts and
+// connections closed by the other side (but not e.g. certificate errors or invalid URLs)
+func isRetryable(err error) bool {
+	if errors.Is(err, ErrServerError) || errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
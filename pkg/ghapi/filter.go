@@ -0,0 +1,69 @@
+package ghapi
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+)
+
+// repoFilter matches repositories (<owner>/<repo>) against exact repository identifiers, glob patterns (e.g. myorg/svc-*) and a regular expression
+type repoFilter struct {
+	names  map[string]bool
+	globs  []string
+	regexp *types.Regexp
+}
+
+// IsRepositoryGlob tells whether a repository list entry is a glob pattern rather than a repository identifier
+func IsRepositoryGlob(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
+
+// ValidateRepositoryPattern checks whether a repository list entry is either a valid repository identifier or a valid glob pattern
+func ValidateRepositoryPattern(entry string) error {
+	if IsRepositoryGlob(entry) {
+		if _, err := path.Match(strings.TrimSpace(entry), ""); err != nil {
+			return fmt.Errorf("Invalid glob pattern '%s': %w", entry, err)
+		}
+		return nil
+	}
+	if _, ok := ValidateAndNormalizeRepositoryIdentifier(entry); !ok {
+		return fmt.Errorf("Failed to validate repository identifier '%s'", entry)
+	}
+	return nil
+}
+
+// newRepoFilter creates a filter from a list of repository identifiers and glob patterns and an optional regular expression
+func newRepoFilter(entries []string, re *types.Regexp) (*repoFilter, error) {
+	filter := &repoFilter{
+		names:  map[string]bool{},
+		regexp: re,
+	}
+	for _, entry := range entries {
+		if err := ValidateRepositoryPattern(entry); err != nil {
+			return nil, err
+		}
+		if IsRepositoryGlob(entry) {
+			filter.globs = append(filter.globs, strings.TrimSpace(entry))
+			continue
+		}
+		repo, _ := ValidateAndNormalizeRepositoryIdentifier(entry)
+		filter.names[repo] = true
+	}
+	return filter, nil
+}
+
+// matches tells whether the given repository (<owner>/<repo>) is matched by any of the filter's entries
+func (filter *repoFilter) matches(repo string) bool {
+	if filter.names[repo] {
+		return true
+	}
+	for _, glob := range filter.globs {
+		// patterns were validated when creating the filter
+		if ok, _ := path.Match(glob, repo); ok {
+			return true
+		}
+	}
+	return filter.regexp != nil && filter.regexp.Regexp != nil && filter.regexp.MatchString(repo)
+}
@@ -0,0 +1,142 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+)
+
+func mustRegexp(source string) *types.Regexp {
+	return &types.Regexp{Regexp: regexp.MustCompile(source), Source: source}
+}
+
+func TestRepoFilterMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		regexp  *types.Regexp
+		repo    string
+		want    bool
+	}{
+		{"exact name", []string{"myorg/svc-a"}, nil, "myorg/svc-a", true},
+		{"exact name normalized from URL", []string{"https://github.com/myorg/svc-a.git"}, nil, "myorg/svc-a", true},
+		{"other name", []string{"myorg/svc-a"}, nil, "myorg/svc-b", false},
+		{"glob", []string{"myorg/svc-*"}, nil, "myorg/svc-payments", true},
+		{"glob of other prefix", []string{"myorg/svc-*"}, nil, "myorg/web-frontend", false},
+		{"glob of other owner", []string{"myorg/svc-*"}, nil, "otherorg/svc-a", false},
+		{"glob doesn't cross slash", []string{"myorg/*"}, nil, "myorg/svc-a/extra", false},
+		{"owner glob doesn't cross slash", []string{"*"}, nil, "myorg/svc-a", false},
+		{"character class glob", []string{"myorg/svc-[ab]"}, nil, "myorg/svc-b", true},
+		{"regexp", nil, mustRegexp(`^myorg/.*-api$`), "myorg/users-api", true},
+		{"regexp not matching", nil, mustRegexp(`^myorg/.*-api$`), "myorg/users-web", false},
+		{"uncompiled regexp", nil, &types.Regexp{Source: ".*"}, "myorg/svc-a", false},
+		{"names and regexp", []string{"myorg/svc-a"}, mustRegexp(`-api$`), "myorg/users-api", true},
+		{"empty filter", nil, nil, "myorg/svc-a", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newRepoFilter(tt.entries, tt.regexp)
+			if err != nil {
+				t.Fatalf("newRepoFilter(%v) failed: %v", tt.entries, err)
+			}
+			if got := filter.matches(tt.repo); got != tt.want {
+				t.Errorf("matches(%q) = %v, want %v", tt.repo, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRepoFilterInvalidGlob(t *testing.T) {
+	if _, err := newRepoFilter([]string{"myorg/svc-a", "myorg/svc-["}, nil); err == nil {
+		t.Error("newRepoFilter with an invalid glob succeeded")
+	}
+}
+
+func TestValidateRepositoryPattern(t *testing.T) {
+	tests := []struct {
+		entry   string
+		wantErr bool
+	}{
+		{"myorg/svc-a", false},
+		{" myorg/svc-a ", false},
+		{"github.com/myorg/svc-a", false},
+		{"git@github.com:myorg/svc-a.git", false},
+		{"myorg/svc-*", false},
+		{"myorg/svc-?", false},
+		{"myorg/svc-[a-c]", false},
+		{"myorg/svc-[", true},
+		{"myorg/svc-[a-", true},
+		{"svc-a", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			err := ValidateRepositoryPattern(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRepositoryPattern(%q) = %v, want error: %v", tt.entry, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateRepoListIncludeOverridesExclude(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/myorg/repos", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]GHAPIResponseRepos{
+			{FullName: "myorg/svc-a"},
+			{FullName: "myorg/svc-b"},
+			{FullName: "myorg/web"},
+		})
+	})
+	mux.HandleFunc("/repos/myorg/extra", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(GHAPIResponseRepos{FullName: "myorg/extra"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	httpClient, retry := HTTPClient, Retry
+	defer func() { HTTPClient, Retry = httpClient, retry }()
+	HTTPClient = server.Client()
+	Retry.MaxRetries = 0
+
+	client := &Client{
+		Auth:         &PersonalAccessToken{Token: "test", Endpoints: &GitHubEndpoints{APIBaseURL: server.URL}},
+		Organization: "myorg",
+	}
+	config := &types.RepositoryConfig{
+		IncludeRepositories: []string{"myorg/svc-a", "myorg/extra"},
+		ExcludeRepositories: []string{"myorg/svc-*"},
+		Discovery:           types.RepositoryDiscoveryConfig{Enabled: true, IncludeForks: true},
+	}
+
+	repos, skipped, err := GenerateRepoList(context.Background(), client, config)
+	if err != nil {
+		t.Fatalf("GenerateRepoList failed: %v", err)
+	}
+
+	var names []string
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+	sort.Strings(names)
+	want := []string{"myorg/extra", "myorg/svc-a", "myorg/web"}
+	if len(names) != len(want) {
+		t.Fatalf("GenerateRepoList returned %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("GenerateRepoList returned %v, want %v", names, want)
+		}
+	}
+	if skipped[REPO_SKIP_REASON_EXCLUDED] != 1 {
+		t.Errorf("GenerateRepoList skipped %d repos as excluded, want 1", skipped[REPO_SKIP_REASON_EXCLUDED])
+	}
+}
@@ -0,0 +1,48 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// GetRepoHooks lists all webhooks configured for the given repository
+func (client *Client) GetRepoHooks(ctx context.Context, repo string) ([]GHAPIResponseHook, error) {
+	hooks := []GHAPIResponseHook{}
+
+	path := fmt.Sprintf("/repos/%s/hooks", repo)
+	err := client.DoPaginatedAPIRequest(ctx, http.MethodGet, path, "repo_hooks", func(body []byte) error {
+		var page []GHAPIResponseHook
+		if err := json.Unmarshal(body, &page); err != nil {
+			return newUnmarshalResponseError(path, err)
+		}
+		hooks = append(hooks, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// GetOrgHooks lists all webhooks configured for the client's organization
+func (client *Client) GetOrgHooks(ctx context.Context) ([]GHAPIResponseHook, error) {
+	hooks := []GHAPIResponseHook{}
+
+	path := fmt.Sprintf("/orgs/%s/hooks", client.Organization)
+	err := client.DoPaginatedAPIRequest(ctx, http.MethodGet, path, "org_hooks", func(body []byte) error {
+		var page []GHAPIResponseHook
+		if err := json.Unmarshal(body, &page); err != nil {
+			return newUnmarshalResponseError(path, err)
+		}
+		hooks = append(hooks, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
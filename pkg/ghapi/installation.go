@@ -6,42 +6,76 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func (ghAppInstallation *GitHubAppInstallation) DoAPIRequest(method, path string) (*http.Response, error) {
-	return doAPIRequest(method, path, ghAppInstallation.Token)
+// DoAPIRequest does a request against the GitHub API authenticated as the App installation
+func (ghAppInstallation *GitHubAppInstallation) DoAPIRequest(ctx context.Context, method, path string) (*http.Response, error) {
+	return doAPIRequest(ctx, ghAppInstallation, method, path)
 }
 
-// RefreshToken uses a JWT token to eventually get an app installation token for git auth
-func (ghAppInstallation *GitHubAppInstallation) RefreshToken(ctx context.Context) error {
-	var err error
+// AuthorizationHeader authenticates with the installation token, which is renewed shortly before it expires
+func (ghAppInstallation *GitHubAppInstallation) AuthorizationHeader(ctx context.Context) (string, error) {
+	ghAppInstallation.tokenMutex.Lock()
+	defer ghAppInstallation.tokenMutex.Unlock()
 
-	ghApp := ghAppInstallation.ParentApp
+	if time.Now().Add(installationTokenRenewalMargin).After(ghAppInstallation.TokenExpirationTime) {
+		log.Debugln("Renewing App Installation Token...")
+		if err := ghAppInstallation.renewToken(ctx); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("Bearer %s", ghAppInstallation.Token), nil
+}
 
-	appToken, err := generateJWT(ghApp.ID, ghApp.PemFile)
+// GetEndpoints returns the API endpoints of the GitHub instance the installation lives on
+func (ghAppInstallation *GitHubAppInstallation) GetEndpoints() *GitHubEndpoints {
+	if ghAppInstallation.Endpoints != nil {
+		return ghAppInstallation.Endpoints
+	}
+	return ghAppInstallation.ParentApp.GetEndpoints()
+}
+
+// RefreshToken uses a JWT token to eventually get an app installation token for git auth
+func (ghAppInstallation *GitHubAppInstallation) RefreshToken(ctx context.Context) error {
+	ghAppInstallation.tokenMutex.Lock()
+	err := ghAppInstallation.renewToken(ctx)
+	ghAppInstallation.tokenMutex.Unlock()
 	if err != nil {
 		return err
 	}
 
-	ghAppInstallation.Token, ghAppInstallation.TokenExpirationTime, err = getAppInstallationToken(appToken, ghAppInstallation.ID)
+	resp, err := ghAppInstallation.DoAPIRequest(ctx, http.MethodGet, "/installation/repositories")
 	if err != nil {
 		return err
 	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// renewToken gets a new installation token (the caller must hold the token mutex)
+func (ghAppInstallation *GitHubAppInstallation) renewToken(ctx context.Context) error {
+	var err error
 
-	if _, err := ghAppInstallation.DoAPIRequest(http.MethodGet, "/installation/repositories"); err != nil {
+	ghApp := ghAppInstallation.ParentApp
+
+	appToken, err := generateJWT(ghApp.ID, ghApp.PemFile)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	ghAppInstallation.Token, ghAppInstallation.TokenExpirationTime, err = getAppInstallationToken(ctx, ghAppInstallation.GetEndpoints(), appToken, ghAppInstallation.ID)
+	return err
 }
 
 // GetDetails fills the GitHub App Installation with some required details (like organization)
-func (ghAppInstallation *GitHubAppInstallation) GetDetails() error {
+func (ghAppInstallation *GitHubAppInstallation) GetDetails(ctx context.Context) error {
 	ghApp := ghAppInstallation.ParentApp
 
-	resp, err := ghApp.DoAPIRequest(http.MethodGet, fmt.Sprintf("/app/installations/%s", ghAppInstallation.ID))
+	resp, err := ghApp.DoAPIRequest(ctx, http.MethodGet, fmt.Sprintf("/app/installations/%s", ghAppInstallation.ID))
 	if err != nil {
 		return err
 	}
@@ -67,23 +101,7 @@ func (ghAppInstallation *GitHubAppInstallation) GetDetails() error {
 
 }
 
-// GetAPIRateLimit fills the GitHub App Installation with some required details (like organization)
-func (ghAppInstallation *GitHubAppInstallation) GetAPIRateLimit() (GHAPIRate, error) {
-	resp, err := ghAppInstallation.DoAPIRequest(http.MethodGet, "/rate_limit")
-	if err != nil {
-		return GHAPIRate{}, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return GHAPIRate{}, err
-	}
-
-	var response GHAPIResponseRateLimit
-	if err := json.Unmarshal(body, &response); err != nil {
-		return GHAPIRate{}, err
-	}
-
-	return response.Rate, nil
+// GetRateLimiter returns the rate limiter tracking the quota of the installation
+func (ghAppInstallation *GitHubAppInstallation) GetRateLimiter() *RateLimiter {
+	return &ghAppInstallation.rateLimiter
 }
@@ -0,0 +1,114 @@
+package ghapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// PaginationConfig controls how list endpoints of the GitHub API are paged through
+type PaginationConfig struct {
+	PerPage  int // number of items requested per page (GitHub allows up to 100)
+	MaxPages int // maximum number of pages fetched per list request (0 = unlimited)
+}
+
+// Pagination is the pagination configuration used for all list requests
+var Pagination = PaginationConfig{
+	PerPage:  DEFAULT_PAGINATION_PER_PAGE,
+	MaxPages: DEFAULT_PAGINATION_MAX_PAGES,
+}
+
+// errStopPagination can be returned by page handlers to stop requesting further pages without failing the request
+var errStopPagination = errors.New("stop pagination")
+
+// linkNextRegexp matches the URL of the next page in a Link header (see https://docs.github.com/en/rest/guides/traversing-with-pagination)
+var linkNextRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPageURL extracts the URL of the next page from the Link header of a response, if there is one
+func nextPageURL(header http.Header) string {
+	for _, link := range header.Values("Link") {
+		if match := linkNextRegexp.FindStringSubmatch(link); len(match) == 2 {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+// withPerPage sets the per_page query parameter on the given request path
+func withPerPage(path string, perPage int) (string, error) {
+	if perPage <= 0 {
+		return path, nil
+	}
+	parsedPath, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+	query := parsedPath.Query()
+	query.Set("per_page", strconv.Itoa(perPage))
+	parsedPath.RawQuery = query.Encode()
+	return parsedPath.String(), nil
+}
+
+// doUncachedAPIRequest does a request and returns the response body and headers
+func doUncachedAPIRequest(ctx context.Context, auth Authenticator, method, path string) ([]byte, http.Header, error) {
+	resp, err := doAPIRequest(ctx, auth, method, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, newReadResponseError(path, err)
+	}
+
+	return body, resp.Header, nil
+}
+
+// doPaginatedAPIRequest requests all pages of a list endpoint by following the Link headers of the responses
+// and passes the body of each page to handlePage, which may return errStopPagination to stop early. The organization and endpoint name are used to label the pagination metrics.
+func doPaginatedAPIRequest(ctx context.Context, auth Authenticator, method, path, organization, endpoint string, handlePage func(body []byte) error) error {
+	next, err := withPerPage(path, Pagination.PerPage)
+	if err != nil {
+		return fmt.Errorf("Failed to set page size on request path '%s': %w", path, err)
+	}
+
+	for page := 1; next != ""; page++ {
+		if Pagination.MaxPages > 0 && page > Pagination.MaxPages {
+			log.Warnf("Reached maximum number of pages (%d) for '%s', results are incomplete", Pagination.MaxPages, path)
+			break
+		}
+
+		var body []byte
+		var header http.Header
+		if method == http.MethodGet && cachedEndpoints[endpoint] {
+			body, header, err = doCachedAPIRequest(ctx, auth, next, organization, endpoint)
+		} else {
+			body, header, err = doUncachedAPIRequest(ctx, auth, method, next)
+		}
+		if err != nil {
+			return err
+		}
+
+		metrics.APIPagesFetchedTotal.WithLabelValues(organization, endpoint).Inc()
+
+		if err := handlePage(body); err != nil {
+			if errors.Is(err, errStopPagination) {
+				break
+			}
+			return err
+		}
+
+		next = nextPageURL(header)
+	}
+
+	return nil
+}
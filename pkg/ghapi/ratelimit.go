@@ -0,0 +1,124 @@
+package ghapi
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	RATE_LIMIT_WAIT_REASON_PACING      = "pacing"
+	RATE_LIMIT_WAIT_REASON_EXHAUSTED   = "budget_exhausted"
+	RATE_LIMIT_WAIT_REASON_RETRY_AFTER = "retry_after"
+)
+
+// RateLimitBudget is the fraction of the rate limit quota the exporter may use, the rest is left for other tools sharing the credentials
+var RateLimitBudget = DEFAULT_RATE_LIMIT_BUDGET
+
+// RateLimiter keeps track of the rate limit of a set of credentials as reported by the API in every response and
+// paces the requests made with them, so that the budgeted quota is spread evenly across the rate limit window
+type RateLimiter struct {
+	mu sync.Mutex
+
+	known     bool // the API reported a rate limit (GitHub Enterprise Server may have rate limiting disabled)
+	limit     int
+	remaining int
+	reset     time.Time
+
+	// pausedUntil is set when the API asked to back off (secondary rate limits)
+	pausedUntil time.Time
+
+	// token bucket allowing short bursts of requests
+	tokens     float64
+	lastRefill time.Time
+}
+
+// Wait blocks until the next request may be made or ctx is done.
+// The organization and installation ID the credentials belong to are used to label the wait metric.
+func (limiter *RateLimiter) Wait(ctx context.Context, organization, installationID string) error {
+	for {
+		limiter.mu.Lock()
+		delay, reason := limiter.reserve(time.Now())
+		limiter.mu.Unlock()
+
+		if delay <= 0 {
+			return nil
+		}
+		if reason != RATE_LIMIT_WAIT_REASON_PACING {
+			log.Warnf("Pausing GitHub API requests for %s (%s)", delay.Round(time.Second), reason)
+		}
+		start := time.Now()
+		err := sleep(ctx, delay)
+		metrics.APIRateLimitWaitSecondsTotal.WithLabelValues(organization, installationID, reason).Add(time.Since(start).Seconds())
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reserve takes a request from the budget and returns how long to wait (and why), if there's nothing left right now
+func (limiter *RateLimiter) reserve(now time.Time) (time.Duration, string) {
+	if now.Before(limiter.pausedUntil) {
+		return limiter.pausedUntil.Sub(now), RATE_LIMIT_WAIT_REASON_RETRY_AFTER
+	}
+	if !limiter.known || !now.Before(limiter.reset) {
+		// no rate limit known for the current window (yet)
+		return 0, ""
+	}
+
+	// requests left for the exporter until the window resets
+	allowed := float64(limiter.remaining) - float64(limiter.limit)*(1-RateLimitBudget)
+	if allowed < 1 {
+		return limiter.reset.Sub(now), RATE_LIMIT_WAIT_REASON_EXHAUSTED
+	}
+
+	rate := allowed / limiter.reset.Sub(now).Seconds() // requests per second
+	limiter.tokens = math.Min(rateLimitBurst, limiter.tokens+now.Sub(limiter.lastRefill).Seconds()*rate)
+	limiter.lastRefill = now
+	if limiter.tokens < 1 {
+		return time.Duration((1 - limiter.tokens) / rate * float64(time.Second)), RATE_LIMIT_WAIT_REASON_PACING
+	}
+
+	limiter.tokens--
+	limiter.remaining-- // until the response tells the actual value
+	return 0, ""
+}
+
+// Update reads the rate limit headers of a response and backs off if the API asks to (Retry-After on 403/429 responses)
+func (limiter *RateLimiter) Update(resp *http.Response) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limit, errLimit := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	remaining, errRemaining := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	reset, errReset := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if errLimit == nil && errRemaining == nil && errReset == nil {
+		limiter.known = true
+		limiter.limit = limit
+		limiter.remaining = remaining
+		limiter.reset = time.Unix(reset, 0)
+	}
+
+	// conditional requests answered with 304 Not Modified don't count against the rate limit, so their token is given back
+	if resp.StatusCode == http.StatusNotModified && limiter.known {
+		limiter.tokens = math.Min(rateLimitBurst, limiter.tokens+1)
+		return
+	}
+
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		limiter.pausedUntil = time.Now().Add(time.Duration(retryAfter) * time.Second)
+		log.Warnf("GitHub API asked to retry after %ds (secondary rate limit)", retryAfter)
+	} else if limiter.known && limiter.remaining == 0 {
+		limiter.pausedUntil = limiter.reset
+		log.Warnf("GitHub API rate limit exceeded, pausing until %s", limiter.reset)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
@@ -15,8 +16,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// repoRegexp matches several variants of repo addresses that can be passed to this application
-var repoRegexp = regexp.MustCompile(`^(?P<protocol>http://|https://|git@)?(?P<github_domain>github\.com)?/?(?P<owner>[A-Za-z0-9-_]+)/(?P<repo>[A-Za-z0-9-_]+)(\.git|/.*)?`)
+// repoRegexp matches several variants of repo addresses that can be passed to this application,
+// e.g. owner/repo, github.com/owner/repo, https://ghe.corp.example/owner/repo or git@ghe.corp.example:owner/repo.git
+var repoRegexp = regexp.MustCompile(`^(?P<protocol>http://|https://|git@)?(?:(?P<github_domain>[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+(?::[0-9]+)?)[/:])?/?(?P<owner>[A-Za-z0-9-_]+)/(?P<repo>[A-Za-z0-9-_.]+?)(\.git)?(/.*)?$`)
 
 // ValidateAndNormalizeRepositoryIdentifier tries to extract the repository identifier in the <owner>/<repo> format and returns it, if possible
 func ValidateAndNormalizeRepositoryIdentifier(identifier string) (string, bool) {
@@ -36,12 +38,101 @@ func ValidateAndNormalizeRepositoryIdentifier(identifier string) (string, bool)
 	return fmt.Sprintf("%s/%s", submatches["owner"], submatches["repo"]), true
 }
 
-func (ghAppInstallation *GitHubAppInstallation) GetReposByTeamSlug(teamSlug string) ([]string, error) {
-	resp, err := ghAppInstallation.DoAPIRequest(http.MethodGet, fmt.Sprintf("/orgs/%s/teams/%s/repos?per_page=100", ghAppInstallation.Organization, teamSlug))
+// GetReposByTeamSlug lists all repositories the given team has access to
+func (client *Client) GetReposByTeamSlug(ctx context.Context, teamSlug string) ([]GHAPIResponseRepos, error) {
+	var response []GHAPIResponseRepos
+
+	err := client.DoPaginatedAPIRequest(ctx, http.MethodGet, fmt.Sprintf("/orgs/%s/teams/%s/repos", client.Organization, teamSlug), "team_repos", func(body []byte) error {
+		var page []GHAPIResponseRepos
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		response = append(response, page...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	return response, nil
+}
+
+// GetOrganizationRepos lists all repositories accessible by the App installation or, when authenticating with a personal access token,
+// all repositories of the organization
+func (client *Client) GetOrganizationRepos(ctx context.Context) ([]GHAPIResponseRepos, error) {
+	var response []GHAPIResponseRepos
+
+	if _, ok := client.Auth.(*GitHubAppInstallation); ok {
+		err := client.DoPaginatedAPIRequest(ctx, http.MethodGet, "/installation/repositories", "installation_repos", func(body []byte) error {
+			var page GHAPIResponseInstallationRepos
+			if err := json.Unmarshal(body, &page); err != nil {
+				return err
+			}
+			response = append(response, page.Repositories...)
+			return nil
+		})
+		return response, err
+	}
+
+	err := client.DoPaginatedAPIRequest(ctx, http.MethodGet, fmt.Sprintf("/orgs/%s/repos?type=all", client.Organization), "org_repos", func(body []byte) error {
+		var page []GHAPIResponseRepos
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		response = append(response, page...)
+		return nil
+	})
+	return response, err
+}
+
+// repoVisibility returns the visibility of a repository, falling back to its private flag if the API doesn't report it (older GitHub Enterprise Server versions)
+func repoVisibility(repo GHAPIResponseRepos) string {
+	if repo.Visibility != "" {
+		return repo.Visibility
+	}
+	if repo.Private {
+		return types.REPO_VISIBILITY_PRIVATE
+	}
+	return types.REPO_VISIBILITY_PUBLIC
+}
+
+// matchesDiscoveryFilters tells whether a discovered repository passes the discovery filters and, if not, why (one of the REPO_SKIP_REASON_* values)
+func matchesDiscoveryFilters(repo *GHAPIResponseRepos, config *types.RepositoryDiscoveryConfig) (bool, string) {
+	if repo.Fork && !config.IncludeForks {
+		return false, REPO_SKIP_REASON_FORK
+	}
+	if len(config.Visibilities) > 0 && !util.ContainsFold(config.Visibilities, repoVisibility(*repo)) {
+		return false, REPO_SKIP_REASON_VISIBILITY
+	}
+	if len(config.Languages) > 0 {
+		language, _ := repo.Language.(string) // null if GitHub couldn't detect the language
+		if !util.ContainsFold(config.Languages, language) {
+			return false, REPO_SKIP_REASON_LANGUAGE
+		}
+	}
+	return true, ""
+}
+
+// isInactiveRepo tells whether a repository is archived or disabled (and not explicitly allowed by the config) and, if so, why
+func isInactiveRepo(repo *GHAPIResponseRepos, config *types.RepositoryConfig) (bool, string) {
+	if repo == nil {
+		return false, ""
+	}
+	if repo.Archived && !config.IncludeArchived {
+		return true, REPO_SKIP_REASON_ARCHIVED
+	}
+	if repo.Disabled && !config.IncludeDisabled {
+		return true, REPO_SKIP_REASON_DISABLED
+	}
+	return false, ""
+}
+
+// GetRepo gets the details of a single repository (<owner>/<repo>)
+func (client *Client) GetRepo(ctx context.Context, repo string) (*GHAPIResponseRepos, error) {
+	resp, err := client.DoAPIRequest(ctx, http.MethodGet, fmt.Sprintf("/repos/%s", repo))
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -49,76 +140,188 @@ func (ghAppInstallation *GitHubAppInstallation) GetReposByTeamSlug(teamSlug stri
 		return nil, err
 	}
 
-	var response []GHAPIResponseRepos
+	var response GHAPIResponseRepos
 	if err := json.Unmarshal(body, &response); err != nil {
 		return nil, err
 	}
 
-	repos := []string{}
-	for _, repo := range response {
-		r, ok := ValidateAndNormalizeRepositoryIdentifier(repo.FullName)
-		if !ok {
-			return nil, fmt.Errorf("Failed to validate repo '%s'", repo.FullName)
-		}
-		repos = append(repos, r)
-	}
+	return &response, nil
+}
 
-	return repos, nil
+// Repository is a repository targeted for inspection
+type Repository struct {
+	Name     string              // <owner>/<repo>
+	Selector string              // the inclusion selector which selected the repository, if any
+	Teams    []string            // slugs of the teams which granted access to the repository (sorted)
+	Metadata *GHAPIResponseRepos // details of the repository as returned by the API (nil if they couldn't be fetched)
 }
 
-// GenerateRepoList generates a list of repositories to target for inspection
-func GenerateRepoList(ctx context.Context, ghAppInstallation *GitHubAppInstallation, config *types.RepositoryConfig) ([]string, error) {
+// GenerateRepoList generates a list of repositories to target for inspection and counts the repositories skipped by reason (one of REPO_SKIP_REASONS).
+// Repositories discovered via teams or the organization are narrowed down to the ones matching any inclusion selector (if configured).
+// They are dropped if they match the exclusion list, regexp or selectors, unless they match the inclusion list, regexp or selectors (INCLUDE > EXCLUDE).
+// Repositories named explicitly in the inclusion list are always added.
+// Archived and disabled repositories are skipped, unless they are allowed by the config.
+func GenerateRepoList(ctx context.Context, client *Client, config *types.RepositoryConfig) ([]Repository, map[string]int, error) {
 	log.Debugf("Generating repository list from config:\n%+v", config)
 
-	repos := make(map[string]bool, 1)
+	skipped := map[string]int{}
+	for _, reason := range REPO_SKIP_REASONS {
+		skipped[reason] = 0
+	}
+
+	includeFilter, err := newRepoFilter(config.IncludeRepositories, config.IncludeRepositoryRegexp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse inclusion list: %w", err)
+	}
+	excludeFilter, err := newRepoFilter(config.ExcludeRepositories, config.ExcludeRepositoryRegexp)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse exclusion list: %w", err)
+	}
+	includeSelectors, includeNeedsProperties, err := parseRepoSelectors(config.IncludeSelectors)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse inclusion selectors: %w", err)
+	}
+	excludeSelectors, excludeNeedsProperties, err := parseRepoSelectors(config.ExcludeSelectors)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse exclusion selectors: %w", err)
+	}
+
+	// candidates holds the discovered repositories along with their metadata and the teams which granted access to them
+	candidates := map[string]*GHAPIResponseRepos{}
+	teams := map[string][]string{}
+	addCandidate := func(repo GHAPIResponseRepos, teamSlug string) error {
+		r, ok := ValidateAndNormalizeRepositoryIdentifier(repo.FullName)
+		if !ok {
+			return fmt.Errorf("Failed to validate repo '%s'", repo.FullName)
+		}
+		candidates[r] = &repo
+		if teamSlug != "" {
+			teams[r] = append(teams[r], teamSlug)
+		}
+		return nil
+	}
 
 	if config.FilterTeamSlugs != nil {
-		for _, teamSlug := range config.FilterTeamSlugs {
+		teamSlugs := config.FilterTeamSlugs
+		if config.IncludeChildTeams {
+			teamSlugs, err = client.ExpandTeamSlugs(ctx, config.FilterTeamSlugs)
+			if err != nil {
+				return nil, nil, err
+			}
+			log.Debugf("Expanded teams %v to %d teams including their child teams", config.FilterTeamSlugs, len(teamSlugs))
+		}
+
+		for _, teamSlug := range teamSlugs {
 			log.Debugf("Fetching repos for team '%s'...", teamSlug)
-			newRepos, err := ghAppInstallation.GetReposByTeamSlug(teamSlug)
+			newRepos, err := client.GetReposByTeamSlug(ctx, teamSlug)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			log.Debugf("Found %d repos for team '%s'", len(newRepos), teamSlug)
 
-			// only add repos that are not already in the list
 			for _, newRepo := range newRepos {
-				if _, exists := repos[newRepo]; !exists {
-					repos[newRepo] = true
+				if err := addCandidate(newRepo, teamSlug); err != nil {
+					return nil, nil, err
 				}
 			}
 		}
 	}
 
-	// drop repos which are on the exlusion list
-	for repo := range repos {
-		for _, nope := range config.ExcludeRepositories {
-			excludeRepo, ok := ValidateAndNormalizeRepositoryIdentifier(nope)
-			if !ok {
-				return nil, fmt.Errorf("Failed to validate repo from exclusion list '%s'", nope)
+	if config.Discovery.Enabled {
+		log.Debugf("Discovering repos of org '%s'...", client.Organization)
+		discovered, err := client.GetOrganizationRepos(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to discover repos of org '%s': %w", client.Organization, err)
+		}
+
+		found := 0
+		for _, repo := range discovered {
+			if ok, reason := matchesDiscoveryFilters(&repo, &config.Discovery); !ok {
+				log.Debugf("Skipping discovered repo '%s' (%s)", repo.FullName, reason)
+				skipped[reason]++
+				continue
+			}
+			if err := addCandidate(repo, ""); err != nil {
+				return nil, nil, err
+			}
+			found++
+		}
+		log.Debugf("Discovered %d repos of org '%s' (%d matching the discovery filters)", len(discovered), client.Organization, found)
+	}
+
+	// custom property values are only fetched if any selector needs them
+	properties := map[string]map[string][]string{}
+	if includeNeedsProperties || excludeNeedsProperties {
+		log.Debugf("Fetching custom property values of repos in org '%s'...", client.Organization)
+		properties, err = client.GetRepoCustomPropertyValues(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to get custom property values of repos in org '%s': %w", client.Organization, err)
+		}
+	}
+
+	repos := map[string]Repository{}
+	for name, metadata := range candidates {
+		if inactive, reason := isInactiveRepo(metadata, config); inactive {
+			log.Debugf("Skipping repo '%s' (%s)", name, reason)
+			skipped[reason]++
+			continue
+		}
+
+		selector, selected := matchRepoSelectors(includeSelectors, metadata, properties[name])
+
+		// narrow down to the repos matching any inclusion selector
+		if len(includeSelectors) > 0 && !selected && !includeFilter.matches(name) {
+			log.Debugf("Repo '%s' doesn't match any inclusion selector", name)
+			skipped[REPO_SKIP_REASON_NOT_SELECTED]++
+			continue
+		}
+
+		// drop repos which match the exclusion list, unless they also match the inclusion list
+		if !selected && !includeFilter.matches(name) {
+			if excludeFilter.matches(name) {
+				log.Debugf("Excluding repo '%s'", name)
+				skipped[REPO_SKIP_REASON_EXCLUDED]++
+				continue
 			}
-			if repo == excludeRepo {
-				delete(repos, repo)
+			if excludeSelector, excluded := matchRepoSelectors(excludeSelectors, metadata, properties[name]); excluded {
+				log.Debugf("Excluding repo '%s' (selector '%s')", name, excludeSelector)
+				skipped[REPO_SKIP_REASON_EXCLUDED]++
+				continue
 			}
 		}
+
+		sort.Strings(teams[name])
+		repos[name] = Repository{Name: name, Selector: selector, Teams: teams[name], Metadata: metadata}
 	}
 
-	// add repos that are on the inclusion list
-	for _, repo := range config.IncludeRepositories {
-		if r, ok := ValidateAndNormalizeRepositoryIdentifier(repo); ok {
-			repos[r] = true
-		} else {
-			return nil, fmt.Errorf("Failed to validate repository identifier '%s'", repo)
+	// add repos that are named on the inclusion list
+	for name := range includeFilter.names {
+		if _, discovered := candidates[name]; discovered {
+			continue
 		}
+
+		// fetch the details of repos which weren't discovered, so that inactive repos can be skipped
+		metadata, err := client.GetRepo(ctx, name)
+		if err != nil {
+			log.Warnf("Failed to get details of included repo '%s', adding it anyway: %+v", name, err)
+		}
+		if inactive, reason := isInactiveRepo(metadata, config); inactive {
+			log.Infof("Skipping included repo '%s' (%s)", name, reason)
+			skipped[reason]++
+			continue
+		}
+
+		selector, _ := matchRepoSelectors(includeSelectors, metadata, properties[name])
+		repos[name] = Repository{Name: name, Selector: selector, Metadata: metadata}
 	}
 
-	repoList := []string{}
-	for repo := range repos {
+	repoList := []Repository{}
+	for _, repo := range repos {
 		repoList = append(repoList, repo)
 	}
 
 	log.Debugf("Filtered repo list contains %d repos", len(repoList))
 
-	return repoList, nil
+	return repoList, skipped, nil
 
 }
@@ -1,45 +1,182 @@
 package ghapi
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func doAPIRequest(method, path, token string) (*http.Response, error) {
-	// ensure leading slash on path
-	if !strings.HasPrefix(path, "/") {
-		path = "/" + path
-	}
+// RetryConfig describes how failed requests are retried
+type RetryConfig struct {
+	MaxRetries     int           // number of retries for transient failures (network errors, server errors, rate limits)
+	InitialBackoff time.Duration // maximum time to wait before the first retry, doubled for every further retry
+	MaxBackoff     time.Duration // upper limit for the time to wait before a retry
+}
+
+// Retry configures the retries of all requests against the GitHub API
+var Retry = RetryConfig{
+	MaxRetries:     DEFAULT_RETRY_MAX_RETRIES,
+	InitialBackoff: DEFAULT_RETRY_INITIAL_BACKOFF,
+	MaxBackoff:     DEFAULT_RETRY_MAX_BACKOFF,
+}
+
+// HTTPClient is used for all requests against the GitHub API. It may be replaced to configure proxies, custom CAs or a test server.
+var HTTPClient = &http.Client{}
+
+// RequestTimeout limits the time a single request against the GitHub API may take (including reading the response body)
+var RequestTimeout = DEFAULT_REQUEST_TIMEOUT
 
-	// construct URL
+// requestSlots limits the number of concurrent requests against the GitHub API across all clients (nil = unlimited)
+var requestSlots chan struct{}
+
+// SetMaxConcurrentRequests limits the number of concurrent requests against the GitHub API across all clients
+func SetMaxConcurrentRequests(max int) {
+	requestSlots = make(chan struct{}, max)
+}
+
+func doAPIRequest(ctx context.Context, auth Authenticator, method, path string) (*http.Response, error) {
+	return doConditionalAPIRequest(ctx, auth, method, path, nil)
+}
+
+// doConditionalAPIRequest does a request with the given additional headers. If they make the request conditional
+// (If-None-Match/If-Modified-Since), a 304 Not Modified response is not considered an error.
+func doConditionalAPIRequest(ctx context.Context, auth Authenticator, method, path string, header http.Header) (*http.Response, error) {
+	// construct URL (absolute URLs, e.g. from Link headers, are used as they are)
+	requestURL := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		// ensure leading slash on path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		requestURL = auth.GetEndpoints().APIBaseURL + path
+	}
 
-	parsedURL, err := url.Parse(GitHubAPIBaseURL + path)
+	parsedURL, err := url.Parse(requestURL)
 	if err != nil {
 		log.Errorf("Failed to parse request URL '%s'", path)
 		return nil, err
 	}
 
+	attempts := 1
+	if method == http.MethodGet || method == http.MethodHead {
+		// only idempotent requests are retried (e.g. no redelivery attempts)
+		attempts += Retry.MaxRetries
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := sendAPIRequest(ctx, auth, method, parsedURL, header)
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !isRetryable(err) {
+			return resp, err
+		}
+
+		backoff := retryBackoff(attempt)
+		log.Debugf("Request '%s %s' failed (attempt %d/%d), retrying in %s: %v", method, parsedURL, attempt, attempts, backoff, err)
+		if err := sleep(ctx, backoff); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sendAPIRequest sends a single request, authenticated with the current credentials
+func sendAPIRequest(ctx context.Context, auth Authenticator, method string, requestURL *url.URL, header http.Header) (*http.Response, error) {
+	// pace requests according to the rate limit
+	rateLimiter := auth.GetRateLimiter()
+	organization, installationID := authLabelValues(auth)
+	if err := rateLimiter.Wait(ctx, organization, installationID); err != nil {
+		return nil, err
+	}
+
+	if requestSlots != nil {
+		select {
+		case requestSlots <- struct{}{}:
+			defer func() { <-requestSlots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// the credentials are only taken now, as waiting for the rate limit may have outlasted the previous ones
+	authorization, err := auth.AuthorizationHeader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to authenticate request: %w", err)
+	}
+
 	var req = &http.Request{
 		Method: method,
-		URL:    parsedURL,
+		URL:    requestURL,
 		Header: http.Header{
-			"Authorization": []string{fmt.Sprintf("Bearer %s", token)},
+			"Authorization": []string{authorization},
 			"Accept":        []string{"application/vnd.github.v3+json"},
 		},
 	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := doWithTimeout(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	rateLimiter.Update(resp)
+
+	if resp.StatusCode == http.StatusNotModified && header != nil {
+		return resp, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newAPIError(req, resp)
+	}
+
+	return resp, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return resp, fmt.Errorf("Request returned non-200 status code (%d)", resp.StatusCode)
+// retryBackoff returns the time to wait before retrying a request after the given attempt (exponential backoff with full jitter)
+func retryBackoff(attempt int) time.Duration {
+	backoff := Retry.MaxBackoff
+	if attempt < 32 && Retry.InitialBackoff<<uint(attempt-1) < Retry.MaxBackoff {
+		backoff = Retry.InitialBackoff << uint(attempt-1)
 	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
 
+// doWithTimeout sends the request with the HTTPClient, limited by the RequestTimeout. The timeout also covers reading the response body.
+func doWithTimeout(ctx context.Context, req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	resp, err := HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
 	return resp, nil
 }
+
+// cancelOnClose releases the context of a request once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnClose) Close() error {
+	defer body.cancel()
+	return body.ReadCloser.Close()
+}
+
+// sleep waits for the given duration or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,127 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const repoSelectorTopicPrefix = "topic:"
+
+// repoSelector selects repositories by a topic (topic:<topic>) or by the value of a custom property (<property>=<value>)
+type repoSelector struct {
+	source   string
+	topic    string
+	property string
+	value    string
+}
+
+// parseRepoSelector parses a repository selector in the format topic:<topic> or <property>=<value>
+func parseRepoSelector(selector string) (repoSelector, error) {
+	selector = strings.TrimSpace(selector)
+	if strings.HasPrefix(selector, repoSelectorTopicPrefix) {
+		topic := strings.TrimSpace(strings.TrimPrefix(selector, repoSelectorTopicPrefix))
+		if topic == "" {
+			return repoSelector{}, fmt.Errorf("Missing topic in repository selector '%s'", selector)
+		}
+		return repoSelector{source: selector, topic: topic}, nil
+	}
+	parts := strings.SplitN(selector, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return repoSelector{}, fmt.Errorf("Invalid repository selector '%s' (must be 'topic:<topic>' or '<property>=<value>')", selector)
+	}
+	return repoSelector{source: selector, property: strings.TrimSpace(parts[0]), value: strings.TrimSpace(parts[1])}, nil
+}
+
+// ValidateRepositorySelector checks whether the given repository selector can be parsed
+func ValidateRepositorySelector(selector string) error {
+	_, err := parseRepoSelector(selector)
+	return err
+}
+
+// parseRepoSelectors parses a list of repository selectors and tells whether any of them needs the custom properties of the repositories
+func parseRepoSelectors(selectors []string) ([]repoSelector, bool, error) {
+	parsed := []repoSelector{}
+	needsProperties := false
+	for _, selector := range selectors {
+		s, err := parseRepoSelector(selector)
+		if err != nil {
+			return nil, false, err
+		}
+		parsed = append(parsed, s)
+		needsProperties = needsProperties || s.property != ""
+	}
+	return parsed, needsProperties, nil
+}
+
+// matches tells whether the repository (with the given custom property values) is selected
+func (selector repoSelector) matches(repo *GHAPIResponseRepos, properties map[string][]string) bool {
+	if selector.topic != "" {
+		if repo == nil {
+			return false
+		}
+		for _, topic := range repo.Topics {
+			if strings.EqualFold(topic, selector.topic) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, value := range properties[selector.property] {
+		if value == selector.value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRepoSelectors returns the first of the selectors which selects the repository
+func matchRepoSelectors(selectors []repoSelector, repo *GHAPIResponseRepos, properties map[string][]string) (string, bool) {
+	for _, selector := range selectors {
+		if selector.matches(repo, properties) {
+			return selector.source, true
+		}
+	}
+	return "", false
+}
+
+// GetRepoCustomPropertyValues lists the custom property values of all repositories of the organization by repository (<owner>/<repo>).
+// Multi-select properties have multiple values.
+func (client *Client) GetRepoCustomPropertyValues(ctx context.Context) (map[string]map[string][]string, error) {
+	values := map[string]map[string][]string{}
+
+	err := client.DoPaginatedAPIRequest(ctx, http.MethodGet, fmt.Sprintf("/orgs/%s/properties/values", client.Organization), "repo_properties", func(body []byte) error {
+		var page []GHAPIResponseRepoPropertyValues
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		for _, repo := range page {
+			r, ok := ValidateAndNormalizeRepositoryIdentifier(repo.RepositoryFullName)
+			if !ok {
+				return fmt.Errorf("Failed to validate repo '%s'", repo.RepositoryFullName)
+			}
+			properties := map[string][]string{}
+			for _, property := range repo.Properties {
+				switch value := property.Value.(type) {
+				case string:
+					properties[property.PropertyName] = []string{value}
+				case []interface{}:
+					for _, v := range value {
+						if s, ok := v.(string); ok {
+							properties[property.PropertyName] = append(properties[property.PropertyName], s)
+						}
+					}
+				}
+			}
+			values[r] = properties
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
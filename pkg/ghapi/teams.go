@@ -0,0 +1,60 @@
+package ghapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GetChildTeams lists the direct child teams of the given team
+func (client *Client) GetChildTeams(ctx context.Context, teamSlug string) ([]GHAPIResponseTeam, error) {
+	var response []GHAPIResponseTeam
+
+	err := client.DoPaginatedAPIRequest(ctx, http.MethodGet, fmt.Sprintf("/orgs/%s/teams/%s/teams", client.Organization, teamSlug), "child_teams", func(body []byte) error {
+		var page []GHAPIResponseTeam
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		response = append(response, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// ExpandTeamSlugs walks the child teams of the given teams recursively and returns the slugs of all teams found, starting with the given ones.
+// Every team is visited only once, so that cycles don't lead to an endless loop.
+func (client *Client) ExpandTeamSlugs(ctx context.Context, teamSlugs []string) ([]string, error) {
+	visited := map[string]bool{}
+	expanded := []string{}
+
+	queue := append([]string{}, teamSlugs...)
+	for len(queue) > 0 {
+		teamSlug := queue[0]
+		queue = queue[1:]
+
+		if visited[teamSlug] {
+			log.Debugf("Skipping team '%s', which was already visited", teamSlug)
+			continue
+		}
+		visited[teamSlug] = true
+		expanded = append(expanded, teamSlug)
+
+		children, err := client.GetChildTeams(ctx, teamSlug)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get child teams of team '%s': %w", teamSlug, err)
+		}
+		for _, child := range children {
+			log.Debugf("Found child team '%s' of team '%s'", child.Slug, teamSlug)
+			queue = append(queue, child.Slug)
+		}
+	}
+
+	return expanded, nil
+}
@@ -0,0 +1,93 @@
+package ghapi
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// requiredTokenScopes are the OAuth scopes of a classic personal access token that allow listing repository webhooks
+var requiredTokenScopes = []string{"admin:repo_hook", "write:repo_hook", "read:repo_hook", "repo"}
+
+// PersonalAccessToken authenticates requests with a classic or fine-grained personal access token
+type PersonalAccessToken struct {
+	Token        string
+	Organization string           // organization the token is used for (only used to label metrics)
+	Endpoints    *GitHubEndpoints // optional, defaults to github.com
+
+	rateLimiter RateLimiter
+}
+
+// NewPersonalAccessToken creates a personal access token authenticator either from the token itself
+// or from a file containing the token (e.g. a mounted Kubernetes secret)
+func NewPersonalAccessToken(token, tokenFile string, endpoints *GitHubEndpoints) (*PersonalAccessToken, error) {
+	token = strings.TrimSpace(token)
+	if token == "" && tokenFile != "" {
+		tokenBytes, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read token file '%s': %w", tokenFile, err)
+		}
+		token = strings.TrimSpace(string(tokenBytes))
+	}
+	if token == "" {
+		return nil, fmt.Errorf("No personal access token given")
+	}
+	return &PersonalAccessToken{
+		Token:     token,
+		Endpoints: endpoints,
+	}, nil
+}
+
+// AuthorizationHeader authenticates with the personal access token
+func (pat *PersonalAccessToken) AuthorizationHeader(ctx context.Context) (string, error) {
+	return fmt.Sprintf("token %s", pat.Token), nil
+}
+
+// GetEndpoints returns the API endpoints of the GitHub instance the token belongs to
+func (pat *PersonalAccessToken) GetEndpoints() *GitHubEndpoints {
+	if pat.Endpoints != nil {
+		return pat.Endpoints
+	}
+	return &DefaultGitHubEndpoints
+}
+
+// IsFineGrained tells whether the token is a fine-grained personal access token, which has permissions instead of scopes
+func (pat *PersonalAccessToken) IsFineGrained() bool {
+	return strings.HasPrefix(pat.Token, "github_pat_")
+}
+
+// GetScopes discovers the OAuth scopes of a classic personal access token from the X-OAuth-Scopes response header
+func (pat *PersonalAccessToken) GetScopes(ctx context.Context) ([]string, error) {
+	resp, err := doAPIRequest(ctx, pat, http.MethodGet, "/rate_limit")
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	scopes := []string{}
+	for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// HasRequiredScopes checks whether the given scopes allow listing repository webhooks
+func HasRequiredScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		for _, required := range requiredTokenScopes {
+			if scope == required {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetRateLimiter returns the rate limiter tracking the quota of the token
+func (pat *PersonalAccessToken) GetRateLimiter() *RateLimiter {
+	return &pat.rateLimiter
+}
@@ -1,14 +1,43 @@
 package ghapi
 
 import (
+	"sync"
 	"time"
 )
 
 const (
-	DEFAULT_GITHUB_API_BASE_URL = "https://api.github.com"
-)
+	DEFAULT_GITHUB_API_BASE_URL     = "https://api.github.com"
+	DEFAULT_GITHUB_UPLOAD_BASE_URL  = "https://uploads.github.com"
+	DEFAULT_GITHUB_GRAPHQL_URL      = "https://api.github.com/graphql"
+	DEFAULT_PAGINATION_PER_PAGE     = 100
+	DEFAULT_PAGINATION_MAX_PAGES    = 50
+	DEFAULT_MAX_CONCURRENT_REQUESTS = 10
+	DEFAULT_RATE_LIMIT_BUDGET       = 1.0
+	DEFAULT_RETRY_MAX_RETRIES       = 3
+	DEFAULT_RETRY_INITIAL_BACKOFF   = 1 * time.Second
+	DEFAULT_RETRY_MAX_BACKOFF       = 30 * time.Second
+	DEFAULT_REQUEST_TIMEOUT         = 30 * time.Second
+
+	// responseCacheMaxAge is the time after which unused cached responses are forgotten
+	responseCacheMaxAge = 24 * time.Hour
+
+	// rateLimitBurst is the number of requests that may be made in a burst without pacing
+	rateLimitBurst = 10
+
+	// MAX_CONCURRENT_REQUESTS is the upper limit for concurrent requests recommended by GitHub to avoid secondary rate limits
+	MAX_CONCURRENT_REQUESTS = 100
+
+	REPO_SKIP_REASON_ARCHIVED     = "archived"
+	REPO_SKIP_REASON_DISABLED     = "disabled"
+	REPO_SKIP_REASON_FORK         = "fork"
+	REPO_SKIP_REASON_VISIBILITY   = "visibility"
+	REPO_SKIP_REASON_LANGUAGE     = "language"
+	REPO_SKIP_REASON_EXCLUDED     = "excluded"
+	REPO_SKIP_REASON_NOT_SELECTED = "not_selected"
 
-var GitHubAPIBaseURL string = DEFAULT_GITHUB_API_BASE_URL
+	// installationTokenRenewalMargin is the time before expiration at which installation tokens are renewed
+	installationTokenRenewalMargin = 1 * time.Minute
+)
 
 // GHAPIResponseHookLastStatus represents the last_response part of a single webhook item in the GitHub repository webhook API response
 type GHAPIResponseHookLastStatus struct {
@@ -77,6 +106,22 @@ type GHAPIResponseHook struct {
 	LastResponse GHAPIResponseHookLastStatus `json:"last_response"`
 }
 
+// GHAPIResponseHookDelivery represents a single list item of the GitHub webhook deliveries API response
+// (see https://docs.github.com/en/rest/webhooks/repo-deliveries#list-deliveries-for-a-repository-webhook)
+type GHAPIResponseHookDelivery struct {
+	ID             int64     `json:"id"`
+	GUID           string    `json:"guid"`
+	DeliveredAt    time.Time `json:"delivered_at"`
+	Redelivery     bool      `json:"redelivery"`
+	Duration       float64   `json:"duration"`
+	Status         string    `json:"status"`
+	StatusCode     int       `json:"status_code"`
+	Event          string    `json:"event"`
+	Action         string    `json:"action"`
+	InstallationID int64     `json:"installation_id"`
+	RepositoryID   int64     `json:"repository_id"`
+}
+
 // GHAPIResponseInstallationTokenSimplified is a simple representation of the response you get when requesting
 // a GitHub App installation token (see https://docs.github.com/en/rest/reference/apps#create-an-installation-access-token-for-an-app)
 type GHAPIResponseInstallationTokenSimplified struct {
@@ -100,6 +145,7 @@ type GHAPIResponseInstallationDetails struct {
 	Events              []string             `json:"events"`
 	SingleFileName      string               `json:"single_file_name"`
 	RepositorySelection string               `json:"repository_selection"`
+	SuspendedAt         *time.Time           `json:"suspended_at"`
 }
 
 type GHAPIResponseAccount struct {
@@ -123,12 +169,64 @@ type GitHubAppInstallation struct {
 	TokenExpirationTime time.Time
 	Organization        string
 	ParentApp           *GitHubApp
+	Endpoints           *GitHubEndpoints // optional, defaults to the endpoints of the parent app
+
+	tokenMutex  sync.Mutex // guards the token while it's renewed by concurrent requests
+	rateLimiter RateLimiter
 }
 
 // GitHubApp holds all config options that we need to authenticate as a GitHub App installation
 type GitHubApp struct {
-	ID      string
-	PemFile string
+	ID        string
+	PemFile   string
+	Endpoints *GitHubEndpoints // optional, defaults to github.com
+
+	rateLimiter RateLimiter
+}
+
+// REPO_SKIP_REASONS are all reasons for which repositories are skipped when generating the repository list
+var REPO_SKIP_REASONS = []string{
+	REPO_SKIP_REASON_ARCHIVED,
+	REPO_SKIP_REASON_DISABLED,
+	REPO_SKIP_REASON_FORK,
+	REPO_SKIP_REASON_VISIBILITY,
+	REPO_SKIP_REASON_LANGUAGE,
+	REPO_SKIP_REASON_EXCLUDED,
+	REPO_SKIP_REASON_NOT_SELECTED,
+}
+
+// GHAPIResponseInstallationRepos is the response of https://docs.github.com/en/rest/apps/installations#list-repositories-accessible-to-the-app-installation
+type GHAPIResponseInstallationRepos struct {
+	TotalCount   int                  `json:"total_count"`
+	Repositories []GHAPIResponseRepos `json:"repositories"`
+}
+
+// GHAPIResponseTeam is an item of the response of https://docs.github.com/en/rest/teams/teams#list-child-teams
+type GHAPIResponseTeam struct {
+	ID          int    `json:"id"`
+	NodeID      string `json:"node_id"`
+	URL         string `json:"url"`
+	HTMLURL     string `json:"html_url"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	Privacy     string `json:"privacy"`
+	Permission  string `json:"permission"`
+	Parent      *struct {
+		ID   int    `json:"id"`
+		Slug string `json:"slug"`
+	} `json:"parent"`
+}
+
+// GHAPIResponseRepoPropertyValues is an item of the response of https://docs.github.com/en/rest/orgs/custom-properties#list-custom-property-values-for-organization-repositories
+type GHAPIResponseRepoPropertyValues struct {
+	RepositoryID       int    `json:"repository_id"`
+	RepositoryName     string `json:"repository_name"`
+	RepositoryFullName string `json:"repository_full_name"`
+	Properties         []struct {
+		PropertyName string      `json:"property_name"`
+		Value        interface{} `json:"value"` // string, list of strings (multi-select) or null
+	} `json:"properties"`
 }
 
 // GHAPIResponseRepos auto-generated by https://mholt.github.io/json-to-go/ from https://docs.github.com/en/rest/reference/teams#list-team-repositories
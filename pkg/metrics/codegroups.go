@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+)
+
+// CodeRange is an inclusive range of HTTP status codes (a single code if both bounds are equal)
+type CodeRange struct {
+	LowerBound int
+	UpperBound int
+}
+
+// CodeGroup is a named group of last webhook responses, used as the code_group label.
+// A response belongs to the group, if it matches all of the given criteria (empty criteria match everything).
+type CodeGroup struct {
+	Name          string
+	Codes         []CodeRange    // status codes of the response (0 = no response)
+	Statuses      []string       // status of the webhook reported by GitHub (e.g. 'unused')
+	MessageRegexp *regexp.Regexp // message of the response reported by GitHub (e.g. 'failed to connect to host')
+}
+
+var (
+	CodeGroupUnused = CodeGroup{
+		Name:     "unused",
+		Codes:    []CodeRange{{0, 0}},
+		Statuses: []string{"unused"},
+	}
+	CodeGroupTimeout = CodeGroup{
+		Name:          "timeout",
+		Codes:         []CodeRange{{0, 0}},
+		MessageRegexp: regexp.MustCompile(`(?i)timed? ?out`),
+	}
+	CodeGroupConnectionFailed = CodeGroup{
+		Name:          "connection_failed",
+		Codes:         []CodeRange{{0, 0}},
+		MessageRegexp: regexp.MustCompile(`(?i)failed to connect|connection refused|connection reset|no such host|could not resolve`),
+	}
+	CodeGroup2xx = CodeGroup{
+		Name:  "2xx",
+		Codes: []CodeRange{{200, 299}},
+	}
+	CodeGroup3xx = CodeGroup{
+		Name:  "3xx",
+		Codes: []CodeRange{{300, 399}},
+	}
+	CodeGroup4xx = CodeGroup{
+		Name:  "4xx",
+		Codes: []CodeRange{{400, 499}},
+	}
+	CodeGroup5xx = CodeGroup{
+		Name:  "5xx",
+		Codes: []CodeRange{{500, 599}},
+	}
+	// CodeGroupOthers is used for responses which don't match any code group
+	CodeGroupOthers = CodeGroup{
+		Name: "xxx",
+	}
+
+	// DefaultCodeGroups are used if no code groups are configured
+	DefaultCodeGroups = []CodeGroup{
+		CodeGroupUnused,
+		CodeGroupTimeout,
+		CodeGroupConnectionFailed,
+		CodeGroup2xx,
+		CodeGroup3xx,
+		CodeGroup4xx,
+		CodeGroup5xx,
+	}
+
+	// CodeGroups are the code groups responses are classified into (the first matching one wins)
+	CodeGroups = DefaultCodeGroups
+)
+
+// Matches tells whether the last response of a webhook belongs to the code group
+func (cg *CodeGroup) Matches(code int, status, message string) bool {
+	if len(cg.Codes) > 0 {
+		found := false
+		for _, r := range cg.Codes {
+			if code >= r.LowerBound && code <= r.UpperBound {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(cg.Statuses) > 0 {
+		found := false
+		for _, s := range cg.Statuses {
+			if strings.EqualFold(s, status) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if cg.MessageRegexp != nil && !cg.MessageRegexp.MatchString(message) {
+		return false
+	}
+	return true
+}
+
+// ClassifyCodeGroup returns the first of the CodeGroups the last response of a webhook belongs to, or CodeGroupOthers
+func ClassifyCodeGroup(code int, status, message string) CodeGroup {
+	for _, cg := range CodeGroups {
+		if cg.Matches(code, status, message) {
+			return cg
+		}
+	}
+	return CodeGroupOthers
+}
+
+// ParseCodeRange parses a single status code (e.g. '404') or an inclusive range of status codes (e.g. '500-599')
+func ParseCodeRange(s string) (CodeRange, error) {
+	bounds := strings.SplitN(strings.TrimSpace(s), "-", 2)
+	lower, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return CodeRange{}, fmt.Errorf("Invalid status code '%s'", bounds[0])
+	}
+	upper := lower
+	if len(bounds) == 2 {
+		upper, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		if err != nil {
+			return CodeRange{}, fmt.Errorf("Invalid status code '%s'", bounds[1])
+		}
+	}
+	if lower < 0 || upper < lower {
+		return CodeRange{}, fmt.Errorf("Invalid status code range '%s'", s)
+	}
+	return CodeRange{LowerBound: lower, UpperBound: upper}, nil
+}
+
+// NewCodeGroup creates a code group from its configuration (the message regexp has to be compiled already)
+func NewCodeGroup(config types.CodeGroupConfig) (CodeGroup, error) {
+	cg := CodeGroup{
+		Name:     config.Name,
+		Statuses: config.Statuses,
+	}
+	if cg.Name == "" {
+		return CodeGroup{}, fmt.Errorf("Code group has no name")
+	}
+	for _, code := range config.Codes {
+		r, err := ParseCodeRange(code)
+		if err != nil {
+			return CodeGroup{}, err
+		}
+		cg.Codes = append(cg.Codes, r)
+	}
+	if config.MessageRegexp != nil {
+		cg.MessageRegexp = config.MessageRegexp.Regexp
+	}
+	if len(cg.Codes) == 0 && len(cg.Statuses) == 0 && cg.MessageRegexp == nil {
+		return CodeGroup{}, fmt.Errorf("Code group '%s' needs at least one of codes, statuses or messageRegexp", cg.Name)
+	}
+	return cg, nil
+}
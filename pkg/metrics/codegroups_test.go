@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+)
+
+func TestClassifyCodeGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		status  string
+		message string
+		want    string
+	}{
+		{"ok", 200, "OK", "OK", "2xx"},
+		{"created", 201, "OK", "Created", "2xx"},
+		{"redirect", 301, "Invalid HTTP Response: 301", "Moved Permanently", "3xx"},
+		{"not found", 404, "Invalid HTTP Response: 404", "Not Found", "4xx"},
+		{"bad gateway", 502, "Invalid HTTP Response: 502", "Bad Gateway", "5xx"},
+		{"unused", 0, "unused", "", "unused"},
+		{"unused case insensitive", 0, "Unused", "", "unused"},
+		{"timeout", 0, "timeout", "Service Timeout", "timeout"},
+		{"timed out", 0, "timeout", "We couldn't deliver this payload: timed out", "timeout"},
+		{"connection refused", 0, "failed to connect", "failed to connect to host", "connection_failed"},
+		{"unknown host", 0, "failed to connect", "no such host", "connection_failed"},
+		{"no response without message", 0, "", "", "xxx"},
+		{"code out of range", 600, "", "", "xxx"},
+		// a status code takes precedence over the message, as the response groups require code 0
+		{"timeout with code", 504, "Invalid HTTP Response: 504", "Gateway Timeout", "5xx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyCodeGroup(tt.code, tt.status, tt.message); got.Name != tt.want {
+				t.Errorf("ClassifyCodeGroup(%d, %q, %q) = %q, want %q", tt.code, tt.status, tt.message, got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyCodeGroupFirstMatchWins(t *testing.T) {
+	defer func(codeGroups []CodeGroup) { CodeGroups = codeGroups }(CodeGroups)
+
+	CodeGroups = []CodeGroup{
+		{Name: "not_found", Codes: []CodeRange{{404, 404}}},
+		{Name: "client_error", Codes: []CodeRange{{400, 499}}},
+		{Name: "gone", Codes: []CodeRange{{410, 410}}},
+	}
+
+	tests := []struct {
+		code int
+		want string
+	}{
+		{404, "not_found"},
+		{410, "client_error"},
+		{400, "client_error"},
+		{500, "xxx"},
+	}
+	for _, tt := range tests {
+		if got := ClassifyCodeGroup(tt.code, "", ""); got.Name != tt.want {
+			t.Errorf("ClassifyCodeGroup(%d) = %q, want %q", tt.code, got.Name, tt.want)
+		}
+	}
+}
+
+func TestParseCodeRange(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    CodeRange
+		wantErr bool
+	}{
+		{"404", CodeRange{404, 404}, false},
+		{" 404 ", CodeRange{404, 404}, false},
+		{"500-599", CodeRange{500, 599}, false},
+		{"500 - 599", CodeRange{500, 599}, false},
+		{"0", CodeRange{0, 0}, false},
+		{"600-500", CodeRange{}, true},
+		{"abc", CodeRange{}, true},
+		{"500-abc", CodeRange{}, true},
+		{"-1", CodeRange{}, true},
+		{"", CodeRange{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseCodeRange(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCodeRange(%q) = %v, want error: %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseCodeRange(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCodeGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  types.CodeGroupConfig
+		wantErr bool
+	}{
+		{"codes", types.CodeGroupConfig{Name: "client_error", Codes: []string{"400-499"}}, false},
+		{"statuses", types.CodeGroupConfig{Name: "unused", Statuses: []string{"unused"}}, false},
+		{"message regexp", types.CodeGroupConfig{Name: "tls", MessageRegexp: &types.Regexp{Regexp: regexp.MustCompile("ssl"), Source: "ssl"}}, false},
+		{"no name", types.CodeGroupConfig{Codes: []string{"404"}}, true},
+		{"no criteria", types.CodeGroupConfig{Name: "everything"}, true},
+		{"invalid range", types.CodeGroupConfig{Name: "backwards", Codes: []string{"600-500"}}, true},
+		{"invalid code", types.CodeGroupConfig{Name: "letters", Codes: []string{"abc"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cg, err := NewCodeGroup(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCodeGroup(%+v) = %v, want error: %v", tt.config, err, tt.wantErr)
+			}
+			if err == nil && cg.Name != tt.config.Name {
+				t.Errorf("NewCodeGroup(%+v) has name %q", tt.config, cg.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WebhookStatus is the last response of a single webhook as seen in a check cycle
+type WebhookStatus struct {
+	Scope         string
+	Repository    string // empty for organization webhooks
+	Selector      string
+	Team          string
+	Webhook       string
+	WebhookID     string
+	Target        string
+	Status        string
+	Code          int
+	CodeGroup     string
+	FailureReason string
+}
+
+// labelValues returns the label values identifying the webhook (without organization and installation ID) as configured in Labels
+func (status *WebhookStatus) labelValues() []string {
+	return []string{status.Scope, status.Repository, status.Selector, status.Team, WebhookLabel(status.Webhook), status.WebhookID, TargetLabel(status.Target)}
+}
+
+var webhookLabels = []string{"organization", "installation_id", "scope", "repository", "selector", "team", "webhook", "webhook_id", "target"}
+
+var (
+	webhookLastStatusCodeTotalDesc = prometheus.NewDesc(
+		"gh_webhook_last_status_code_total",
+		"Total Number of Status Codes collected from the 'Last Webhook Response'",
+		append(webhookLabels, "status", "code", "code_group"), nil,
+	)
+	webhookLastStatusCodeGroupDesc = prometheus.NewDesc(
+		"gh_webhook_last_status_code_group",
+		"The last HTTP status code per webhook (1 = active)",
+		append(webhookLabels, "status", "code_group"), nil,
+	)
+	webhookLastFailureReasonDesc = prometheus.NewDesc(
+		"gh_webhook_last_failure_reason",
+		"Why the last response per webhook failed, classified from its message ('ok' if it didn't, 1 = active)",
+		append(webhookLabels, "reason"), nil,
+	)
+	webhookInfoDesc = prometheus.NewDesc(
+		"gh_webhook_info",
+		"Descriptive labels of every webhook, which can be joined onto the other webhook metrics (always 1)",
+		[]string{"organization", "installation_id", "scope", "repository", "webhook_id", "webhook", "target"}, nil,
+	)
+)
+
+// installationKey identifies the monitor of a single installation (or personal access token)
+type installationKey struct {
+	organization   string
+	installationID string
+}
+
+// webhookKey identifies a webhook of an installation
+type webhookKey struct {
+	installationKey
+	scope      string
+	repository string
+	webhookID  string
+}
+
+// statusCodeCount is a series of the status code counter
+type statusCodeCount struct {
+	webhook     webhookKey
+	labelValues []string
+	count       float64
+}
+
+// WebhookStatusCollector serves the webhook statuses of the last completed check cycle of every installation.
+// Snapshots are swapped in as a whole, so that scrapes never see a partially checked cycle, and webhooks which
+// disappeared (deleted hooks, repositories dropped from the list) are removed with the next snapshot.
+type WebhookStatusCollector struct {
+	mu         sync.RWMutex
+	snapshots  map[installationKey][]WebhookStatus
+	codeCounts map[string]*statusCodeCount // by joined label values
+}
+
+// NewWebhookStatusCollector creates an empty collector
+func NewWebhookStatusCollector() *WebhookStatusCollector {
+	return &WebhookStatusCollector{
+		snapshots:  map[installationKey][]WebhookStatus{},
+		codeCounts: map[string]*statusCodeCount{},
+	}
+}
+
+// WebhookStatuses serves the webhook statuses of all monitors
+var WebhookStatuses = NewWebhookStatusCollector()
+
+func init() {
+	prometheus.MustRegister(WebhookStatuses)
+}
+
+// Describe implements prometheus.Collector
+func (collector *WebhookStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- webhookLastStatusCodeTotalDesc
+	ch <- webhookLastStatusCodeGroupDesc
+	ch <- webhookLastFailureReasonDesc
+	ch <- webhookInfoDesc
+}
+
+// Collect implements prometheus.Collector
+func (collector *WebhookStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.mu.RLock()
+	defer collector.mu.RUnlock()
+
+	for key, statuses := range collector.snapshots {
+		for _, status := range statuses {
+			labelValues := append([]string{key.organization, key.installationID}, status.labelValues()...)
+			ch <- prometheus.MustNewConstMetric(webhookLastStatusCodeGroupDesc, prometheus.GaugeValue, 1, append(labelValues, StatusLabel(status.Status), status.CodeGroup)...)
+			ch <- prometheus.MustNewConstMetric(webhookLastFailureReasonDesc, prometheus.GaugeValue, 1, append(labelValues, status.FailureReason)...)
+			ch <- prometheus.MustNewConstMetric(webhookInfoDesc, prometheus.GaugeValue, 1, key.organization, key.installationID, status.Scope, status.Repository, status.WebhookID, status.Webhook, status.Target)
+		}
+	}
+	for _, c := range collector.codeCounts {
+		ch <- prometheus.MustNewConstMetric(webhookLastStatusCodeTotalDesc, prometheus.CounterValue, c.count, c.labelValues...)
+	}
+}
+
+// Publish swaps in the webhook statuses of a completed check cycle of an installation and counts their status codes.
+// The statuses of the repositories in keep (whose webhooks couldn't be listed in this cycle) are carried over from the last snapshot.
+func (collector *WebhookStatusCollector) Publish(organization, installationID string, statuses []WebhookStatus, keep map[string]bool) {
+	key := installationKey{organization: organization, installationID: installationID}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	snapshot := make([]WebhookStatus, 0, len(statuses))
+	snapshot = append(snapshot, statuses...)
+	for _, status := range collector.snapshots[key] {
+		if keep[status.Repository] {
+			snapshot = append(snapshot, status)
+		}
+	}
+	collector.snapshots[key] = snapshot
+
+	for _, status := range statuses {
+		labelValues := append([]string{organization, installationID}, status.labelValues()...)
+		labelValues = append(labelValues, StatusLabel(status.Status), strconv.Itoa(status.Code), status.CodeGroup)
+		id := strings.Join(labelValues, "\x00")
+		c, exists := collector.codeCounts[id]
+		if !exists {
+			c = &statusCodeCount{
+				webhook:     webhookKey{installationKey: key, scope: status.Scope, repository: status.Repository, webhookID: status.WebhookID},
+				labelValues: labelValues,
+			}
+			collector.codeCounts[id] = c
+		}
+		c.count++
+	}
+
+	// drop the counters of webhooks which disappeared
+	current := map[webhookKey]bool{}
+	for _, status := range snapshot {
+		current[webhookKey{installationKey: key, scope: status.Scope, repository: status.Repository, webhookID: status.WebhookID}] = true
+	}
+	for id, c := range collector.codeCounts {
+		if c.webhook.installationKey == key && !current[c.webhook] {
+			delete(collector.codeCounts, id)
+		}
+	}
+}
+
+// Remove drops all webhook statuses of an installation, e.g. when it's no longer monitored
+func (collector *WebhookStatusCollector) Remove(organization, installationID string) {
+	key := installationKey{organization: organization, installationID: installationID}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	delete(collector.snapshots, key)
+	for id, c := range collector.codeCounts {
+		if c.webhook.installationKey == key {
+			delete(collector.codeCounts, id)
+		}
+	}
+}
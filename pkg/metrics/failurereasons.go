@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	FAILURE_REASON_OK              = "ok"
+	FAILURE_REASON_UNUSED          = "unused"
+	FAILURE_REASON_CONNECT_REFUSED = "connect_refused"
+	FAILURE_REASON_DNS             = "dns"
+	FAILURE_REASON_TLS             = "tls"
+	FAILURE_REASON_TIMEOUT         = "timeout"
+	FAILURE_REASON_HTTP_ERROR      = "http_error"
+	FAILURE_REASON_OTHER           = "other"
+)
+
+// failureReasonPatterns match the message of the last response of a webhook reported by GitHub to a failure reason (the first matching one wins)
+var failureReasonPatterns = []struct {
+	reason  string
+	pattern *regexp.Regexp
+}{
+	{FAILURE_REASON_TLS, regexp.MustCompile(`(?i)ssl|tls|certificate|x509`)},
+	{FAILURE_REASON_DNS, regexp.MustCompile(`(?i)no such host|could not resolve|name resolution|dns`)},
+	{FAILURE_REASON_TIMEOUT, regexp.MustCompile(`(?i)timed? ?out`)},
+	{FAILURE_REASON_CONNECT_REFUSED, regexp.MustCompile(`(?i)failed to connect|connection refused|connection reset`)},
+	{FAILURE_REASON_HTTP_ERROR, regexp.MustCompile(`(?i)invalid http response`)},
+}
+
+// ClassifyFailureReason tells why the last response of a webhook failed (or FAILURE_REASON_OK, if it didn't).
+// The result is one of the FAILURE_REASON_* constants, so that it can be used as a label.
+func ClassifyFailureReason(code int, status, message string) string {
+	if strings.EqualFold(status, "unused") {
+		return FAILURE_REASON_UNUSED
+	}
+	if code >= 200 && code <= 299 {
+		return FAILURE_REASON_OK
+	}
+	for _, p := range failureReasonPatterns {
+		if p.pattern.MatchString(message) {
+			return p.reason
+		}
+	}
+	if code > 0 {
+		return FAILURE_REASON_HTTP_ERROR
+	}
+	return FAILURE_REASON_OTHER
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import "testing"
+
+func TestClassifyFailureReason(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		status  string
+		message string
+		want    string
+	}{
+		{"ok", 200, "OK", "OK", FAILURE_REASON_OK},
+		{"created", 201, "OK", "Created", FAILURE_REASON_OK},
+		{"unused", 0, "unused", "", FAILURE_REASON_UNUSED},
+		{"unused case insensitive", 0, "Unused", "", FAILURE_REASON_UNUSED},
+		{"tls", 0, "failed to connect", "Peer certificate cannot be authenticated with given CA certificates", FAILURE_REASON_TLS},
+		{"x509", 0, "", "x509: certificate signed by unknown authority", FAILURE_REASON_TLS},
+		{"dns", 0, "failed to connect", "Couldn't connect to server: no such host", FAILURE_REASON_DNS},
+		{"could not resolve", 0, "", "Could not resolve host: hooks.example.com", FAILURE_REASON_DNS},
+		{"timeout", 0, "timeout", "Service Timeout", FAILURE_REASON_TIMEOUT},
+		{"timed out", 0, "", "We couldn't deliver this payload: timed out", FAILURE_REASON_TIMEOUT},
+		{"connection refused", 0, "failed to connect", "failed to connect to host", FAILURE_REASON_CONNECT_REFUSED},
+		{"connection reset", 0, "", "Connection reset by peer", FAILURE_REASON_CONNECT_REFUSED},
+		{"invalid http response", 0, "", "Invalid HTTP Response", FAILURE_REASON_HTTP_ERROR},
+		{"not found", 404, "Invalid HTTP Response: 404", "Not Found", FAILURE_REASON_HTTP_ERROR},
+		{"bad gateway", 502, "Invalid HTTP Response: 502", "Bad Gateway", FAILURE_REASON_HTTP_ERROR},
+		{"timeout with code", 504, "Invalid HTTP Response: 504", "Gateway Timeout", FAILURE_REASON_TIMEOUT},
+		{"unknown", 0, "", "", FAILURE_REASON_OTHER},
+		{"unknown message", 0, "", "something went wrong", FAILURE_REASON_OTHER},
+		// the first matching pattern wins
+		{"tls before timeout", 0, "", "TLS handshake timed out", FAILURE_REASON_TLS},
+		{"dns before connect", 0, "", "failed to connect: no such host", FAILURE_REASON_DNS},
+		{"timeout before connect", 0, "", "failed to connect: timed out", FAILURE_REASON_TIMEOUT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyFailureReason(tt.code, tt.status, tt.message); got != tt.want {
+				t.Errorf("ClassifyFailureReason(%d, %q, %q) = %q, want %q", tt.code, tt.status, tt.message, got, tt.want)
+			}
+		})
+	}
+}
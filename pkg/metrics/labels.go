@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/iwilltry42/gh-webhook-monitor/pkg/types"
+)
+
+// Labels configures the descriptive labels put on the metrics (an empty label value drops the label)
+var Labels = types.MetricsLabelsConfig{
+	Webhook:           true,
+	Target:            types.METRICS_TARGET_LABEL_FULL,
+	Status:            types.METRICS_STATUS_LABEL_RAW,
+	RepositoryFilters: true,
+}
+
+// normalizedStatuses are the statuses of the last webhook response kept by the normalized status label, anything else is 'other'
+var normalizedStatuses = []string{"active", "unused", "misconfigured"}
+
+// WebhookLabel returns the value of the webhook label for the API URL of a webhook
+func WebhookLabel(webhook string) string {
+	if !Labels.Webhook {
+		return ""
+	}
+	return webhook
+}
+
+// TargetLabel returns the value of the target label for the target URL of a webhook
+func TargetLabel(target string) string {
+	switch Labels.Target {
+	case types.METRICS_TARGET_LABEL_HOST:
+		parsed, err := url.Parse(target)
+		if err != nil || parsed.Host == "" {
+			return "invalid"
+		}
+		return parsed.Host
+	case types.METRICS_TARGET_LABEL_HASH:
+		sum := sha256.Sum256([]byte(target))
+		return hex.EncodeToString(sum[:6])
+	case types.METRICS_TARGET_LABEL_NONE:
+		return ""
+	default:
+		return target
+	}
+}
+
+// StatusLabel returns the value of the status label for the status of the last response of a webhook
+func StatusLabel(status string) string {
+	switch Labels.Status {
+	case types.METRICS_STATUS_LABEL_NORMALIZED:
+		for _, s := range normalizedStatuses {
+			if strings.EqualFold(s, strings.TrimSpace(status)) {
+				return s
+			}
+		}
+		return "other"
+	case types.METRICS_STATUS_LABEL_NONE:
+		return ""
+	default:
+		return status
+	}
+}
@@ -5,99 +5,202 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-type CodeGroup struct {
-	Name       string
-	LowerBound int
-	UpperBound int
-}
-
 var (
-	CodeGroupUnused = CodeGroup{
-		Name:       "unused",
-		LowerBound: 0,
-		UpperBound: 0,
-	}
-	CodeGroup2xx = CodeGroup{
-		Name:       "2xx",
-		LowerBound: 200,
-		UpperBound: 299,
-	}
-	CodeGroup3xx = CodeGroup{
-		Name:       "3xx",
-		LowerBound: 300,
-		UpperBound: 399,
-	}
-	CodeGroup4xx = CodeGroup{
-		Name:       "4xx",
-		LowerBound: 400,
-		UpperBound: 499,
-	}
-	CodeGroup5xx = CodeGroup{
-		Name:       "5xx",
-		LowerBound: 500,
-		UpperBound: 599,
-	}
-	CodeGroupOthers = CodeGroup{
-		Name:       "xxx",
-		LowerBound: 999,
-		UpperBound: 999,
-	}
-
-	CodeGroups = []CodeGroup{
-		CodeGroupUnused,
-		CodeGroup2xx,
-		CodeGroup3xx,
-		CodeGroup4xx,
-		CodeGroup5xx,
-	}
-
-	WebhookLastStatusCodeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "gh_webhook_last_status_code_total",
-		Help: "Total Number of Status Codes collected from the 'Last Webhook Response'",
+	WebhookDeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gh_webhook_deliveries_total",
+		Help: "Total number of webhook deliveries collected from the deliveries API",
+	}, []string{
+		"organization",
+		"installation_id",
+		"scope",
+		"repository",
+		"webhook_id",
+		"target",
+		"status_code",
+		"event",
+		"redelivery",
+	})
+
+	WebhookDeliveryDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gh_webhook_delivery_duration_seconds",
+		Help:    "Duration of webhook deliveries as reported by the deliveries API",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 9), // 50ms ... 12.8s (GitHub times out after 10s)
+	}, []string{
+		"organization",
+		"installation_id",
+		"scope",
+		"repository",
+		"webhook_id",
+		"target",
+	})
+
+	WebhookRedeliveryAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gh_webhook_redelivery_attempts_total",
+		Help: "Total number of redelivery attempts for failed webhook deliveries (outcome: requested, dry_run, error)",
 	}, []string{
+		"organization",
+		"installation_id",
+		"scope",
 		"repository",
-		"webhook",
 		"webhook_id",
 		"target",
-		"status",
-		"code",
-		"code_group",
+		"event",
+		"outcome",
 	})
 
-	WebhookLastStatusCodeGroup = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "gh_webhook_last_status_code_group",
-		Help: "The last HTTP status code per webhook (1 = active)",
+	WebhookRedeliveriesCompletedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gh_webhook_redeliveries_completed_total",
+		Help: "Total number of failed webhook deliveries no longer considered for redelivery (result: succeeded, expired, budget_exhausted)",
 	}, []string{
+		"organization",
+		"installation_id",
+		"scope",
 		"repository",
-		"webhook",
 		"webhook_id",
 		"target",
-		"status",
-		"code_group",
+		"event",
+		"result",
+	})
+
+	RepositoryCheckDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gh_webhook_repository_check_duration_seconds",
+		Help:    "Duration of fetching and processing the webhooks of a single repository",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10), // 50ms ... 25.6s
+	}, []string{
+		"organization",
+		"installation_id",
+	})
+
+	CheckCycleDurationSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gh_webhook_check_cycle_duration_seconds",
+		Help: "Duration of the last complete check of all webhooks",
+	}, []string{
+		"organization",
+		"installation_id",
 	})
 
 	RepositoryFailedWebhookListTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "gh_webhooks_repository_list_failed_total",
 		Help: "Total number of failed webhook lists per repository",
 	}, []string{
+		"organization",
+		"installation_id",
 		"repository",
 		"error",
 	})
 
+	OrganizationFailedWebhookListTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gh_webhooks_organization_list_failed_total",
+		Help: "Total number of failed webhook lists per organization",
+	}, []string{
+		"organization",
+		"installation_id",
+		"error",
+	})
+
+	WebhookFailedDeliveryListTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gh_webhook_deliveries_list_failed_total",
+		Help: "Total number of failed webhook delivery lists per webhook",
+	}, []string{
+		"organization",
+		"installation_id",
+		"scope",
+		"repository",
+		"webhook_id",
+		"error",
+	})
+
 	APIRateLimitRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "gh_webhook_api_rate_limit_remaining",
 		Help: "Remaining API Requests before hitting the limit",
 	}, []string{
 		"app_id",
 		"installation_id",
+		"organization",
 	})
 
 	RepositoryListCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "gh_webhook_repositories",
 		Help: "Number of Repositories checked by the Exporter",
 	}, []string{
+		"organization",
+		"installation_id",
 		"team_filters",
 		"include_filters",
 		"exclude_filters",
 	})
+
+	RepositoryListLastRefreshTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gh_webhook_repositories_last_refresh_timestamp_seconds",
+		Help: "Timestamp of the last successful refresh of the repository list",
+	}, []string{
+		"organization",
+		"installation_id",
+	})
+
+	RepositorySkippedCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gh_webhook_repositories_skipped",
+		Help: "Number of Repositories skipped in the last refresh of the repository list by reason",
+	}, []string{
+		"organization",
+		"installation_id",
+		"reason",
+	})
+
+	APICacheHitsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gh_webhook_api_cache_hits_total",
+		Help: "Total number of conditional requests answered with 304 Not Modified, served from the response cache",
+	}, []string{
+		"organization",
+		"endpoint",
+	})
+
+	APICacheMissesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gh_webhook_api_cache_misses_total",
+		Help: "Total number of requests to cached endpoints which returned a new response",
+	}, []string{
+		"organization",
+		"endpoint",
+	})
+
+	APIRateLimitWaitSecondsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gh_webhook_api_rate_limit_wait_seconds_total",
+		Help: "Total time requests against the GitHub API were held back to respect the rate limit",
+	}, []string{
+		"organization",
+		"installation_id",
+		"reason",
+	})
+
+	APIPagesFetchedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gh_webhook_api_pages_fetched_total",
+		Help: "Total number of pages fetched from paginated GitHub API list endpoints",
+	}, []string{
+		"organization",
+		"endpoint",
+	})
+
+	APITokenScopes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gh_webhook_api_token_scopes",
+		Help: "OAuth scopes of the personal access token used for authentication (1 = granted)",
+	}, []string{
+		"scope",
+	})
+
+	AppInstallationsCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gh_webhook_app_installations",
+		Help: "Number of GitHub App installations monitored by the Exporter",
+	}, []string{
+		"app_id",
+	})
+
+	ConfigReloadSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gh_webhook_config_reload_success",
+		Help: "Whether the last configuration reload succeeded (1 = success)",
+	})
+
+	ConfigLastReloadTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gh_webhook_config_last_reload_timestamp_seconds",
+		Help: "Timestamp of the last successful configuration (re)load",
+	})
 )
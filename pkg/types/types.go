@@ -8,17 +8,201 @@ import (
 const (
 	DEFAULT_WAIT_TIME              = 5 * time.Minute
 	DEFAULT_REPO_REFRESH_WAIT_TIME = 1 * time.Hour
+
+	DEFAULT_INSTALLATION_REFRESH_WAIT_TIME = 1 * time.Hour
+
+	DEFAULT_WEBHOOK_WORKERS = 4
+
+	DEFAULT_REDELIVERY_MAX_AGE      = 24 * time.Hour
+	DEFAULT_REDELIVERY_MAX_ATTEMPTS = 3
+
+	WEBHOOK_SCOPE_REPO = "repo"
+	WEBHOOK_SCOPE_ORG  = "org"
+
+	REPO_VISIBILITY_PUBLIC   = "public"
+	REPO_VISIBILITY_PRIVATE  = "private"
+	REPO_VISIBILITY_INTERNAL = "internal"
+
+	DEFAULT_LISTEN_ADDRESS   = ":8080"
+	DEFAULT_METRICS_PATH     = "/metrics"
+	DEFAULT_SHUTDOWN_TIMEOUT = 30 * time.Second
+
+	METRICS_TARGET_LABEL_FULL = "full" // the target URL as it is
+	METRICS_TARGET_LABEL_HOST = "host" // only the host of the target URL
+	METRICS_TARGET_LABEL_HASH = "hash" // a short hash of the target URL
+	METRICS_TARGET_LABEL_NONE = "none" // no target label
+
+	METRICS_STATUS_LABEL_RAW        = "raw"        // the status as reported by GitHub
+	METRICS_STATUS_LABEL_NORMALIZED = "normalized" // the status mapped to a fixed set of values
+	METRICS_STATUS_LABEL_NONE       = "none"       // no status label
 )
 
+// DEFAULT_WEBHOOK_SCOPES are the webhook scopes checked if none are configured
+var DEFAULT_WEBHOOK_SCOPES = []string{WEBHOOK_SCOPE_REPO}
+
+// Config is the complete configuration of the exporter, read from the configuration file and the environment
+type Config struct {
+	GitHub       GitHubConfig     `mapstructure:"github" yaml:"github"`
+	Intervals    IntervalConfig   `mapstructure:"intervals" yaml:"intervals"`
+	Repositories RepositoryConfig `mapstructure:"repositories" yaml:"repositories"`
+	Webhooks     WebhookConfig    `mapstructure:"webhooks" yaml:"webhooks"`
+	Metrics      MetricsConfig    `mapstructure:"metrics" yaml:"metrics"`
+	Server       ServerConfig     `mapstructure:"server" yaml:"server"`
+	Debug        bool             `mapstructure:"debug" yaml:"debug"`
+}
+
+// GitHubConfig describes how to reach and authenticate against the GitHub API
+type GitHubConfig struct {
+	APIBaseURL   string          `mapstructure:"apiBaseURL" yaml:"apiBaseURL"`
+	UploadURL    string          `mapstructure:"uploadURL" yaml:"uploadURL"`
+	GraphQLURL   string          `mapstructure:"graphqlURL" yaml:"graphqlURL"`
+	Organization string          `mapstructure:"organization" yaml:"organization"`
+	App          GitHubAppConfig `mapstructure:"app" yaml:"app"`
+	Token        string          `mapstructure:"token" yaml:"token"`
+	TokenFile    string          `mapstructure:"tokenFile" yaml:"tokenFile"`
+	PerPage      int             `mapstructure:"perPage" yaml:"perPage"`
+	MaxPages     int             `mapstructure:"maxPages" yaml:"maxPages"`
+
+	MaxConcurrentRequests int     `mapstructure:"maxConcurrentRequests" yaml:"maxConcurrentRequests"` // limit for concurrent requests against the GitHub API across all installations
+	RateLimitBudget       float64 `mapstructure:"rateLimitBudget" yaml:"rateLimitBudget"`             // fraction of the rate limit quota the exporter may use
+
+	MaxRetries   int           `mapstructure:"maxRetries" yaml:"maxRetries"`     // number of retries for transient failures of GET requests
+	RetryBackoff time.Duration `mapstructure:"retryBackoff" yaml:"retryBackoff"` // maximum time to wait before the first retry (doubled for every further retry)
+
+	RequestTimeout time.Duration `mapstructure:"requestTimeout" yaml:"requestTimeout"` // limit for the time a single request may take
+}
+
+// GitHubAppConfig describes the GitHub App used for authentication
+type GitHubAppConfig struct {
+	ID             string `mapstructure:"id" yaml:"id"`
+	PemFile        string `mapstructure:"pemFile" yaml:"pemFile"`
+	InstallationID string `mapstructure:"installationID" yaml:"installationID"` // empty = all installations
+}
+
+// IntervalConfig describes how often the exporter does its work
+type IntervalConfig struct {
+	Wait                time.Duration `mapstructure:"wait" yaml:"wait"`                               // time to wait between iterations
+	RepoRefresh         time.Duration `mapstructure:"repoRefresh" yaml:"repoRefresh"`                 // time to wait before refreshing the list of repositories
+	InstallationRefresh time.Duration `mapstructure:"installationRefresh" yaml:"installationRefresh"` // time to wait before discovering the App installations again
+}
+
+// MetricsConfig describes how metrics are exposed
+type MetricsConfig struct {
+	Path       string              `mapstructure:"path" yaml:"path"`
+	CodeGroups []CodeGroupConfig   `mapstructure:"codeGroups" yaml:"codeGroups"` // replaces the default code groups (the first matching one wins)
+	Labels     MetricsLabelsConfig `mapstructure:"labels" yaml:"labels"`
+}
+
+// MetricsLabelsConfig describes which (descriptive) labels are put on the metrics, to limit their cardinality
+type MetricsLabelsConfig struct {
+	Webhook           bool   `mapstructure:"webhook" yaml:"webhook"`                     // API URL of the webhook
+	Target            string `mapstructure:"target" yaml:"target"`                       // full, host, hash or none
+	Status            string `mapstructure:"status" yaml:"status"`                       // raw, normalized or none
+	RepositoryFilters bool   `mapstructure:"repositoryFilters" yaml:"repositoryFilters"` // team, include and exclude filters on gh_webhook_repositories
+}
+
+// CodeGroupConfig describes a group of last webhook responses exposed in the code_group label
+type CodeGroupConfig struct {
+	Name          string   `mapstructure:"name" yaml:"name"`
+	Codes         []string `mapstructure:"codes" yaml:"codes"`                 // status codes (e.g. '404') or inclusive ranges (e.g. '500-599'), 0 = no response
+	Statuses      []string `mapstructure:"statuses" yaml:"statuses"`           // status of the webhook reported by GitHub (e.g. 'unused')
+	MessageRegexp *Regexp  `mapstructure:"messageRegexp" yaml:"messageRegexp"` // message of the response reported by GitHub
+}
+
+// ServerConfig describes the HTTP server of the exporter
+type ServerConfig struct {
+	ListenAddress   string        `mapstructure:"listenAddress" yaml:"listenAddress"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdownTimeout" yaml:"shutdownTimeout"` // time to let in-flight checks finish on shutdown before they're aborted
+}
+
+// Regexp is a regular expression which can be read from the configuration file.
+// It has to be compiled using Compile before it can be used.
+type Regexp struct {
+	*regexp.Regexp
+	Source string
+}
+
+// UnmarshalYAML reads the regular expression from a YAML string
+func (r *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshal(&r.Source)
+}
+
+// Compile compiles the regular expression from its source
+func (r *Regexp) Compile() error {
+	compiled, err := regexp.Compile(r.Source)
+	if err != nil {
+		return err
+	}
+	r.Regexp = compiled
+	return nil
+}
+
 // RepositoryConfig describes the configuration for targeted repositories
 type RepositoryConfig struct {
-	IncludeRepositories     []string       `mapstructure:"include" yaml:"include"`
-	ExcludeRepositories     []string       `mapstructure:"exclude" yaml:"exclude"`
-	IncludeRepositoryRegexp *regexp.Regexp `mapstructure:"includeRegexp" yaml:"includeRegexp"`
-	ExcludeRepositoryRegexp *regexp.Regexp `mapstructure:"excludeRegexp" yaml:"excludeRegexp"`
-	FilterTeamSlugs         []string       `mapstructure:"teamSlugs" yaml:"teamSlugs"`
+	IncludeRepositories     []string `mapstructure:"include" yaml:"include"`
+	ExcludeRepositories     []string `mapstructure:"exclude" yaml:"exclude"`
+	IncludeRepositoryRegexp *Regexp  `mapstructure:"includeRegexp" yaml:"includeRegexp"`
+	ExcludeRepositoryRegexp *Regexp  `mapstructure:"excludeRegexp" yaml:"excludeRegexp"`
+	FilterTeamSlugs         []string `mapstructure:"teamSlugs" yaml:"teamSlugs"`
+	IncludeChildTeams       bool     `mapstructure:"includeChildTeams" yaml:"includeChildTeams"` // also get repositories from all (nested) child teams
+	IncludeSelectors        []string `mapstructure:"includeSelectors" yaml:"includeSelectors"`   // topic:<topic> or <property>=<value>
+	ExcludeSelectors        []string `mapstructure:"excludeSelectors" yaml:"excludeSelectors"`   // topic:<topic> or <property>=<value>
+	IncludeArchived         bool     `mapstructure:"includeArchived" yaml:"includeArchived"`     // don't skip archived repositories
+	IncludeDisabled         bool     `mapstructure:"includeDisabled" yaml:"includeDisabled"`     // don't skip disabled repositories
+
+	Discovery RepositoryDiscoveryConfig `mapstructure:"discovery" yaml:"discovery"`
 }
 
+// RepositoryDiscoveryConfig describes the discovery of all repositories of the organization (or all repositories accessible by the App installation)
+type RepositoryDiscoveryConfig struct {
+	Enabled      bool     `mapstructure:"enabled" yaml:"enabled"`
+	Visibilities []string `mapstructure:"visibilities" yaml:"visibilities"` // public, private and/or internal (empty = all)
+	IncludeForks bool     `mapstructure:"includeForks" yaml:"includeForks"` // also discover forks
+	Languages    []string `mapstructure:"languages" yaml:"languages"`       // primary languages of the repositories (empty = all)
+}
+
+// WebhookConfig describes which webhooks are checked and how
 type WebhookConfig struct {
-	FilterTargetURLRegexp *regexp.Regexp
+	FilterTargetURLRegexp *Regexp          `mapstructure:"targetRegexp" yaml:"targetRegexp"`
+	Scopes                []string         `mapstructure:"scopes" yaml:"scopes"`                       // scopes of webhooks to check (repo and/or org)
+	Workers               int              `mapstructure:"workers" yaml:"workers"`                     // number of repositories checked concurrently (per installation)
+	CollectDeliveries     bool             `mapstructure:"collectDeliveries" yaml:"collectDeliveries"` // collect the delivery history of each webhook from the deliveries API
+	Redelivery            RedeliveryConfig `mapstructure:"redelivery" yaml:"redelivery"`
+}
+
+// RedeliveryConfig describes the policy for automatically redelivering failed webhook deliveries
+type RedeliveryConfig struct {
+	Enabled               bool          `mapstructure:"enabled" yaml:"enabled"`
+	DryRun                bool          `mapstructure:"dryRun" yaml:"dryRun"`             // only log and count redeliveries instead of requesting them
+	Events                []string      `mapstructure:"events" yaml:"events"`             // event types to redeliver (empty = all)
+	FilterTargetURLRegexp *Regexp       `mapstructure:"targetRegexp" yaml:"targetRegexp"` // only redeliver deliveries of webhooks with matching target URLs
+	MinAge                time.Duration `mapstructure:"minAge" yaml:"minAge"`             // wait at least this long after the failed delivery before redelivering it
+	MaxAge                time.Duration `mapstructure:"maxAge" yaml:"maxAge"`             // give up on deliveries older than this
+	MaxAttempts           int           `mapstructure:"maxAttempts" yaml:"maxAttempts"`   // maximum number of redelivery attempts per delivery
+}
+
+// Matches tells whether failed deliveries of the given event to the given target URL should be redelivered
+func (config *RedeliveryConfig) Matches(event, targetURL string) bool {
+	if config.FilterTargetURLRegexp != nil && !config.FilterTargetURLRegexp.MatchString(targetURL) {
+		return false
+	}
+	if len(config.Events) == 0 {
+		return true
+	}
+	for _, e := range config.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope tells whether webhooks of the given scope should be checked
+func (config *WebhookConfig) HasScope(scope string) bool {
+	for _, s := range config.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
@@ -1,5 +1,7 @@
 package util
 
+import "strings"
+
 // MapSubexpNames maps regex capturing group names to corresponding matches
 func MapSubexpNames(names, matches []string) map[string]string {
 	//names, matches = names[1:], matches[1:]
@@ -9,3 +11,13 @@ func MapSubexpNames(names, matches []string) map[string]string {
 	}
 	return nameMatchMap
 }
+
+// ContainsFold tells whether the list contains the given string, ignoring case
+func ContainsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}